@@ -0,0 +1,515 @@
+package bloomd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultAliasTimeout = 10 * time.Second
+
+	// Prefix of the marker filters a ServerAliasStore encodes aliases in.
+	_ALIAS_PREFIX = "__bloomd_alias__"
+	// Separates the fields of a marker filter name, escaped within them.
+	_ALIAS_SEPARATOR = ":"
+
+	// Parameters of the marker filters, which never hold any key.
+	_ALIAS_MARKER_CAPACITY    = 10000
+	_ALIAS_MARKER_PROBABILITY = 0.01
+)
+
+// Alias maps a logical filter name to the physical filter reads and writes
+// go to.
+type Alias struct {
+	// Target is the filter reads and writes go to.
+	Target string `json:"target"`
+	// DualWrite lists filters writes also go to, e.g. the filter being
+	// rebuilt before the cut over, or the previous target to roll back to.
+	DualWrite []string `json:"dual_write,omitempty"`
+	// DualWriteUntil ends the dual writes. Zero keeps them until the alias
+	// changes.
+	DualWriteUntil time.Time `json:"dual_write_until"`
+}
+
+// writes returns the filters writes also go to at the time.
+func (a Alias) writes(now time.Time) []string {
+	if !a.DualWriteUntil.IsZero() && !now.Before(a.DualWriteUntil) {
+		return nil
+	}
+	return a.DualWrite
+}
+
+// AliasStore persists the aliases, so every client sharing the store resolves
+// the same names.
+type AliasStore interface {
+	// Load returns every alias by name.
+	Load(ctx context.Context) (map[string]Alias, error)
+	// Store replaces the alias atomically, or removes it when it has no
+	// target.
+	Store(ctx context.Context, name string, alias Alias) error
+}
+
+// FileAliasStore keeps the aliases in a local JSON file, replaced atomically
+// on every change. It is safe for concurrent use within a process, but
+// concurrent writers in several processes may lose each other's changes.
+type FileAliasStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileAliasStore returns a store keeping the aliases in the file. A
+// missing file holds no alias.
+func NewFileAliasStore(path string) *FileAliasStore {
+	return &FileAliasStore{path: path}
+}
+
+// Load returns every alias in the file.
+func (s *FileAliasStore) Load(ctx context.Context) (map[string]Alias, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Store replaces the alias in the file.
+func (s *FileAliasStore) Store(ctx context.Context, name string, alias Alias) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aliases, err := s.load()
+	if err != nil {
+		return err
+	}
+	if alias.Target == "" {
+		delete(aliases, name)
+	} else {
+		aliases[name] = alias
+	}
+
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "bloomd: unable to encode aliases")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "bloomd: unable to write aliases")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "bloomd: unable to write aliases")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "bloomd: unable to write aliases")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "bloomd: unable to write aliases")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), s.path), "bloomd: unable to write aliases")
+}
+
+func (s *FileAliasStore) load() (map[string]Alias, error) {
+	aliases := make(map[string]Alias)
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return aliases, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to read aliases")
+	}
+
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, errors.Wrapf(err, "bloomd: invalid aliases in %s", s.path)
+	}
+	return aliases, nil
+}
+
+// ServerAliasStore keeps the aliases on bloomD itself, encoded in the names of
+// empty marker filters such as
+// `__bloomd_alias__:users:00000000000000000002:users_v2:users_v1:1792300000`.
+// A change creates a marker with the next revision before dropping the older
+// ones, and the newest revision wins, so readers never see a missing alias.
+// Marker names must fit bloomD's limit on filter names.
+type ServerAliasStore struct {
+	client *Client
+	mu     sync.Mutex
+}
+
+// NewServerAliasStore returns a store keeping the aliases on the server the
+// client talks to. The client must not resolve aliases itself.
+func NewServerAliasStore(client *Client) *ServerAliasStore {
+	return &ServerAliasStore{client: client}
+}
+
+// Load returns the newest revision of every alias.
+func (s *ServerAliasStore) Load(ctx context.Context) (map[string]Alias, error) {
+	markers, err := s.markers(ctx, _ALIAS_PREFIX+_ALIAS_SEPARATOR)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string]Alias)
+	revisions := make(map[string]int64)
+	for _, m := range markers {
+		if rev, ok := revisions[m.name]; !ok || m.revision > rev {
+			aliases[m.name] = m.alias
+			revisions[m.name] = m.revision
+		}
+	}
+	return aliases, nil
+}
+
+// Store creates a marker for the next revision of the alias, then drops the
+// markers of the previous revisions. Removing the alias drops them all.
+func (s *ServerAliasStore) Store(ctx context.Context, name string, alias Alias) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	markers, err := s.markers(ctx, aliasMarkerPrefix(name))
+	if err != nil {
+		return err
+	}
+
+	if alias.Target != "" {
+		var revision int64
+		for _, m := range markers {
+			if m.revision > revision {
+				revision = m.revision
+			}
+		}
+
+		marker := aliasMarker{name: name, revision: revision + 1, alias: alias}
+		err := s.client.CreateWithParams(ctx, marker.filter(), _ALIAS_MARKER_CAPACITY, _ALIAS_MARKER_PROBABILITY, false)
+		if err != nil {
+			return errors.Wrapf(err, "bloomd: unable to store alias %s", name)
+		}
+	}
+
+	for _, m := range markers {
+		if err := s.client.Drop(ctx, m.filter()); err != nil && err != FilterDoesNotExist {
+			return errors.Wrapf(err, "bloomd: unable to drop alias marker %s", m.filter())
+		}
+	}
+	return nil
+}
+
+func (s *ServerAliasStore) markers(ctx context.Context, prefix string) ([]aliasMarker, error) {
+	filters, err := s.client.ListByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to list aliases")
+	}
+
+	markers := make([]aliasMarker, 0, len(filters))
+	for _, filter := range filters {
+		if m, err := parseAliasMarker(filter.Name); err == nil {
+			markers = append(markers, m)
+		}
+	}
+	return markers, nil
+}
+
+// aliasMarker is a revision of an alias encoded in a filter name.
+type aliasMarker struct {
+	name     string
+	revision int64
+	alias    Alias
+}
+
+var (
+	aliasEscaper   = strings.NewReplacer("%", "%25", _ALIAS_SEPARATOR, "%3A", ",", "%2C")
+	aliasUnescaper = strings.NewReplacer("%3A", _ALIAS_SEPARATOR, "%2C", ",", "%25", "%")
+)
+
+func aliasMarkerPrefix(name string) string {
+	return _ALIAS_PREFIX + _ALIAS_SEPARATOR + aliasEscaper.Replace(name) + _ALIAS_SEPARATOR
+}
+
+func (m aliasMarker) filter() string {
+	dual := make([]string, len(m.alias.DualWrite))
+	for i, name := range m.alias.DualWrite {
+		dual[i] = aliasEscaper.Replace(name)
+	}
+
+	var until int64
+	if !m.alias.DualWriteUntil.IsZero() {
+		until = m.alias.DualWriteUntil.Unix()
+	}
+
+	return fmt.Sprintf("%s%020d%s%s%s%s%s%d",
+		aliasMarkerPrefix(m.name), m.revision,
+		_ALIAS_SEPARATOR, aliasEscaper.Replace(m.alias.Target),
+		_ALIAS_SEPARATOR, strings.Join(dual, ","),
+		_ALIAS_SEPARATOR, until)
+}
+
+// parseAliasMarker decodes the alias from the name of a marker filter.
+func parseAliasMarker(filter string) (aliasMarker, error) {
+	fields := strings.Split(filter, _ALIAS_SEPARATOR)
+	if len(fields) != 6 || fields[0] != _ALIAS_PREFIX || fields[1] == "" || fields[3] == "" {
+		return aliasMarker{}, errors.Errorf("bloomd: %s is not an alias marker", filter)
+	}
+
+	revision, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || revision < 1 {
+		return aliasMarker{}, errors.Errorf("bloomd: %s is not an alias marker", filter)
+	}
+	until, err := strconv.ParseInt(fields[5], 10, 64)
+	if err != nil {
+		return aliasMarker{}, errors.Errorf("bloomd: %s is not an alias marker", filter)
+	}
+
+	m := aliasMarker{
+		name:     aliasUnescaper.Replace(fields[1]),
+		revision: revision,
+		alias:    Alias{Target: aliasUnescaper.Replace(fields[3])},
+	}
+	if fields[4] != "" {
+		for _, name := range strings.Split(fields[4], ",") {
+			m.alias.DualWrite = append(m.alias.DualWrite, aliasUnescaper.Replace(name))
+		}
+	}
+	if until > 0 {
+		m.alias.DualWriteUntil = time.Unix(until, 0)
+	}
+	return m, nil
+}
+
+// aliasResolver holds the aliases loaded from the store, refreshing them in
+// the background to pick up changes made by other clients.
+type aliasResolver struct {
+	store AliasStore
+	now   func() time.Time
+
+	mu      sync.RWMutex
+	aliases map[string]Alias
+	// Serializes changes, so a swap reads the alias it replaces.
+	swap sync.Mutex
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// newAliasResolver loads the aliases from the store and starts refreshing
+// them every interval, unless zero or less.
+func newAliasResolver(store AliasStore, interval time.Duration) (*aliasResolver, error) {
+	r := &aliasResolver{
+		store:   store,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAliasTimeout)
+	defer cancel()
+	if err := r.reload(ctx); err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to load aliases")
+	}
+
+	go r.loop(interval)
+	return r, nil
+}
+
+func (r *aliasResolver) loop(interval time.Duration) {
+	defer close(r.stopped)
+
+	if interval <= 0 {
+		<-r.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultAliasTimeout)
+			r.reload(ctx)
+			cancel()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *aliasResolver) reload(ctx context.Context) error {
+	aliases, err := r.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.aliases = aliases
+	r.mu.Unlock()
+	return nil
+}
+
+// resolve returns the filter the name refers to, and the filters writes also
+// go to.
+func (r *aliasResolver) resolve(name string) (string, []string) {
+	r.mu.RLock()
+	alias, ok := r.aliases[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return name, nil
+	}
+	return alias.Target, alias.writes(r.now())
+}
+
+func (r *aliasResolver) get(name string) (Alias, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	alias, ok := r.aliases[name]
+	return alias, ok
+}
+
+func (r *aliasResolver) set(ctx context.Context, name string, alias Alias) error {
+	if err := r.store.Store(ctx, name, alias); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	aliases := make(map[string]Alias, len(r.aliases)+1)
+	for n, a := range r.aliases {
+		aliases[n] = a
+	}
+	if alias.Target == "" {
+		delete(aliases, name)
+	} else {
+		aliases[name] = alias
+	}
+	r.aliases = aliases
+	return nil
+}
+
+func (r *aliasResolver) snapshot() map[string]Alias {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	aliases := make(map[string]Alias, len(r.aliases))
+	for n, a := range r.aliases {
+		aliases[n] = a
+	}
+	return aliases
+}
+
+func (r *aliasResolver) close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	<-r.stopped
+}
+
+// SetAlias points the alias to its target, replacing it atomically for every
+// client sharing the store. Writes to the alias also go to the dual-write
+// filters until the alias says otherwise.
+func (t *Client) SetAlias(ctx context.Context, name string, alias Alias) error {
+	if t.aliases == nil {
+		return errors.New("bloomd: no alias store configured")
+	}
+	if alias.Target == "" || alias.Target == name {
+		return errors.Errorf("bloomd: invalid target for alias %s", name)
+	}
+
+	t.aliases.swap.Lock()
+	defer t.aliases.swap.Unlock()
+	return t.aliases.set(ctx, name, alias)
+}
+
+// SwapAlias cuts the alias over to the target. For the dual-write period,
+// writes also go to the previous target, so it can be swapped back to without
+// losing keys. A period of zero or less stops writing to it right away.
+func (t *Client) SwapAlias(ctx context.Context, name string, target string, dualWrite time.Duration) error {
+	if t.aliases == nil {
+		return errors.New("bloomd: no alias store configured")
+	}
+	if target == "" || target == name {
+		return errors.Errorf("bloomd: invalid target for alias %s", name)
+	}
+
+	t.aliases.swap.Lock()
+	defer t.aliases.swap.Unlock()
+
+	alias := Alias{Target: target}
+	if previous, ok := t.aliases.get(name); ok && dualWrite > 0 && previous.Target != target {
+		alias.DualWrite = []string{previous.Target}
+		// Rounded up to the second, the precision of the server store.
+		alias.DualWriteUntil = t.aliases.now().Add(dualWrite + time.Second - 1).Truncate(time.Second)
+	}
+	return t.aliases.set(ctx, name, alias)
+}
+
+// RemoveAlias removes the alias, so the name refers to the filter of that
+// name again.
+func (t *Client) RemoveAlias(ctx context.Context, name string) error {
+	if t.aliases == nil {
+		return errors.New("bloomd: no alias store configured")
+	}
+
+	t.aliases.swap.Lock()
+	defer t.aliases.swap.Unlock()
+	return t.aliases.set(ctx, name, Alias{})
+}
+
+// Aliases returns the aliases currently resolved by the client. It is empty
+// unless the client was created with `WithAliases`.
+func (t *Client) Aliases() map[string]Alias {
+	if t.aliases == nil {
+		return map[string]Alias{}
+	}
+	return t.aliases.snapshot()
+}
+
+// ReloadAliases loads the aliases from the store again, picking up changes
+// made by other clients before the next background refresh.
+func (t *Client) ReloadAliases(ctx context.Context) error {
+	if t.aliases == nil {
+		return errors.New("bloomd: no alias store configured")
+	}
+	return t.aliases.reload(ctx)
+}
+
+// resolve returns the filter the name refers to.
+func (t *Client) resolve(name string) string {
+	if t.aliases == nil {
+		return name
+	}
+	target, _ := t.aliases.resolve(name)
+	return target
+}
+
+// resolveWrite returns the filter the name refers to, and the filters writes
+// also go to.
+func (t *Client) resolveWrite(name string) (string, []string) {
+	if t.aliases == nil {
+		return name, nil
+	}
+	return t.aliases.resolve(name)
+}
+
+// dualWrite runs the write against every dual-write filter, returning the
+// first failure.
+func dualWrite(filters []string, write func(name string) error) error {
+	for _, name := range filters {
+		if err := write(name); err != nil {
+			return errors.Wrapf(err, "bloomd: dual write to %s failed", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package bloomd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliasSwap(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	store := NewFileAliasStore(filepath.Join(t.TempDir(), "aliases.json"))
+	client, err := NewClient(server.Addr(), WithAliases(store))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.CreateWithParams(ctx, "users_v1", 1000, 0.01, false))
+	assert.NoError(client.CreateWithParams(ctx, "users_v2", 2000, 0.001, false))
+	assert.NoError(client.SetAlias(ctx, "users", Alias{Target: "users_v1"}))
+
+	_, err = client.Set(ctx, "users", "a")
+	assert.NoError(err)
+	assert.True(server.Has("users_v1", "a"))
+	info, err := client.Info(ctx, "users")
+	assert.NoError(err)
+	assert.Equal(1000, info.Capacity)
+
+	// Writes go to both filters while the new one is rebuilt.
+	assert.NoError(client.SetAlias(ctx, "users", Alias{Target: "users_v1", DualWrite: []string{"users_v2"}}))
+	_, err = client.Bulk(ctx, "users", "b", "c")
+	assert.NoError(err)
+	assert.True(server.Has("users_v1", "b"))
+	assert.True(server.Has("users_v2", "c"))
+	_, err = client.Bulk(ctx, "users_v2", "a")
+	assert.NoError(err)
+
+	// After the cut over, the previous filter is written to for the period.
+	assert.NoError(client.SwapAlias(ctx, "users", "users_v2", time.Minute))
+	alias := client.Aliases()["users"]
+	assert.Equal("users_v2", alias.Target)
+	assert.Equal([]string{"users_v1"}, alias.DualWrite)
+
+	results, err := client.Multi(ctx, "users", "a", "b", "d")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true, false}, results)
+	_, err = client.Set(ctx, "users", "d")
+	assert.NoError(err)
+	assert.True(server.Has("users_v1", "d"))
+	assert.True(server.Has("users_v2", "d"))
+
+	client.aliases.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = client.Set(ctx, "users", "e")
+	assert.NoError(err)
+	assert.False(server.Has("users_v1", "e"))
+	assert.True(server.Has("users_v2", "e"))
+
+	// Another client sharing the store resolves the same names.
+	other, err := NewClient(server.Addr(), WithAliases(store))
+	assert.NoError(err)
+	defer other.Shutdown()
+	present, err := other.Check(ctx, "users", "e")
+	assert.NoError(err)
+	assert.True(present)
+
+	assert.NoError(client.RemoveAlias(ctx, "users"))
+	assert.NoError(other.ReloadAliases(ctx))
+	assert.Empty(other.Aliases())
+	_, err = other.Check(ctx, "users", "e")
+	assert.Equal(FilterDoesNotExist, err)
+
+	assert.Error(client.SwapAlias(ctx, "users", "users", 0))
+	plain, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer plain.Shutdown()
+	assert.Error(plain.SwapAlias(ctx, "users", "users_v2", 0))
+	assert.Empty(plain.Aliases())
+}
+
+func TestServerAliasStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	admin, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer admin.Shutdown()
+
+	store := NewServerAliasStore(admin)
+	client, err := NewClient(server.Addr(), WithAliases(store), WithAliasRefresh(0))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	until := time.Unix(1792300000, 0)
+	assert.NoError(client.SetAlias(ctx, "users", Alias{Target: "users_v1"}))
+	assert.NoError(client.SetAlias(ctx, "odd:name,%", Alias{
+		Target:         "users_v2",
+		DualWrite:      []string{"a:b", "c,d"},
+		DualWriteUntil: until,
+	}))
+	assert.NoError(client.SwapAlias(ctx, "users", "users_v2", time.Hour))
+
+	// Only the newest revision of each alias is left.
+	markers, err := admin.ListByPrefix(ctx, _ALIAS_PREFIX)
+	assert.NoError(err)
+	assert.Len(markers, 2)
+
+	aliases, err := store.Load(ctx)
+	assert.NoError(err)
+	assert.Equal(client.Aliases(), aliases)
+	assert.Equal("users_v2", aliases["users"].Target)
+	assert.Equal([]string{"users_v1"}, aliases["users"].DualWrite)
+	assert.Equal(Alias{Target: "users_v2", DualWrite: []string{"a:b", "c,d"}, DualWriteUntil: until}, aliases["odd:name,%"])
+
+	assert.NoError(client.RemoveAlias(ctx, "users"))
+	markers, err = admin.ListByPrefix(ctx, _ALIAS_PREFIX)
+	assert.NoError(err)
+	assert.Len(markers, 1)
+
+	_, err = parseAliasMarker(_ALIAS_PREFIX + ":users:x:users_v1::0")
+	assert.Error(err)
+}
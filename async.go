@@ -0,0 +1,245 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SetAsync sets a key in a filter without blocking. Overlapping asynchronous
+// requests are pipelined over shared connections. Like `Set`, it creates
+// filters with a template on first use. The sets in the dual-write filters of
+// an alias are not waited for.
+func (t *Client) SetAsync(ctx context.Context, name string, key string) *BoolFuture {
+	f := newBoolFuture()
+
+	if err := t.checkWritable(); err != nil {
+		f.resolve(false, err)
+		return f
+	}
+
+	name, dual := t.resolveWrite(name)
+	for _, other := range dual {
+		t.submitSet(ctx, other, key, true, func(bool, error) {})
+	}
+	t.submitSet(ctx, name, key, true, f.resolve)
+
+	return f
+}
+
+// submitSet queues a set and calls done with its result. With retry a set
+// failing because the filter does not exist is queued once more after
+// creating it, see `autoCreated`.
+func (t *Client) submitSet(ctx context.Context, name string, key string, retry bool, done func(bool, error)) {
+	t.pipeline.submit(&pipelineRequest{
+		ctx: ctx,
+		cmd: t.buildCommand(_SET, name, key),
+		done: func(resp string, err error) {
+			if err != nil {
+				added, err := t.setOffline(name, []string{key}, err)
+				if err != nil {
+					done(false, err)
+					return
+				}
+				done(added[0], nil)
+				return
+			}
+
+			added, err := parseBool(resp)
+			if retry && errors.Cause(err) == FilterDoesNotExist {
+				t.autoCreatedAsync(ctx, name, err, func() {
+					t.submitSet(ctx, name, key, false, done)
+				}, func() {
+					done(false, err)
+				})
+				return
+			}
+			if err == nil {
+				t.cacheSet(name, key)
+			}
+			done(added, err)
+		},
+	})
+}
+
+// autoCreatedAsync calls retry once the filter was created, see
+// `autoCreated`, or fail otherwise. Creating the filter blocks, so it runs in
+// a goroutine of its own rather than hold up the pipeline.
+func (t *Client) autoCreatedAsync(ctx context.Context, name string, err error, retry func(), fail func()) {
+	go func() {
+		if t.autoCreated(ctx, name, err) {
+			retry()
+		} else {
+			fail()
+		}
+	}()
+}
+
+// CheckAsync checks if a key is in a filter without blocking. Overlapping
+// asynchronous requests are pipelined over shared connections.
+func (t *Client) CheckAsync(ctx context.Context, name string, key string) *BoolFuture {
+	f := newBoolFuture()
+	name = t.resolve(name)
+
+	if t.cache != nil && t.cache.get(name, key) {
+		f.resolve(true, nil)
+		return f
+	}
+
+	t.pipeline.submit(&pipelineRequest{
+		ctx: ctx,
+		cmd: t.buildCommand(_CHECK, name, key),
+		done: func(resp string, err error) {
+			if err != nil {
+				f.resolve(t.checkFallback(name, key, err))
+				return
+			}
+
+			present, err := parseBool(resp)
+			if err == nil && present && t.cache != nil {
+				t.cache.add(name, key)
+			}
+			f.resolve(present, err)
+		},
+	})
+
+	return f
+}
+
+// BulkAsync sets many items in a filter without blocking. The request is
+// split like `Bulk` and every chunk is pipelined. Like `Bulk`, it creates
+// filters with a template on first use. The sets in the dual-write filters of
+// an alias are not waited for.
+func (t *Client) BulkAsync(ctx context.Context, name string, keys ...string) *BoolsFuture {
+	f := newBoolsFuture()
+
+	if err := t.checkWritable(); err != nil {
+		f.resolve(nil, err)
+		return f
+	}
+
+	name, dual := t.resolveWrite(name)
+	for _, other := range dual {
+		t.submitBulk(ctx, other, keys, true, func([]bool, error) {})
+	}
+	t.submitBulk(ctx, name, keys, true, f.resolve)
+
+	return f
+}
+
+// submitBulk queues the chunks of a bulk and calls done with their results,
+// retrying like `submitSet`.
+func (t *Client) submitBulk(ctx context.Context, name string, keys []string, retry bool, done func([]bool, error)) {
+	t.submitBatch(ctx, _BULK, name, keys, func(results []bool, err error) {
+		if retry && errors.Cause(err) == FilterDoesNotExist {
+			t.autoCreatedAsync(ctx, name, err, func() {
+				t.submitBulk(ctx, name, keys, false, done)
+			}, func() {
+				done(nil, err)
+			})
+			return
+		}
+		if err != nil {
+			done(t.setOffline(name, keys, err))
+			return
+		}
+
+		t.cacheSet(name, keys...)
+		done(results, nil)
+	})
+}
+
+// MultiAsync checks whether multiple keys exist in the filter without
+// blocking. The request is split like `Multi` and every chunk is pipelined.
+func (t *Client) MultiAsync(ctx context.Context, name string, keys ...string) *BoolsFuture {
+	f := newBoolsFuture()
+	name = t.resolve(name)
+
+	if t.cache == nil {
+		t.submitBatch(ctx, _MULTI, name, keys, func(results []bool, err error) {
+			if err != nil {
+				f.resolve(t.multiFallback(name, keys, err))
+				return
+			}
+			f.resolve(results, nil)
+		})
+		return f
+	}
+
+	results := make([]bool, len(keys))
+	missing := make([]int, 0, len(keys))
+	for i, key := range keys {
+		if t.cache.get(name, key) {
+			results[i] = true
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		f.resolve(results, nil)
+		return f
+	}
+
+	missingKeys := make([]string, len(missing))
+	for i, idx := range missing {
+		missingKeys[i] = keys[idx]
+	}
+
+	t.submitBatch(ctx, _MULTI, name, missingKeys, func(fetched []bool, err error) {
+		if err != nil {
+			assumed, err := t.multiFallback(name, missingKeys, err)
+			if err != nil {
+				f.resolve(nil, err)
+				return
+			}
+			for i, idx := range missing {
+				results[idx] = assumed[i]
+			}
+			f.resolve(results, nil)
+			return
+		}
+
+		present := make([]string, 0, len(missing))
+		for i, idx := range missing {
+			results[idx] = fetched[i]
+			if fetched[i] {
+				present = append(present, keys[idx])
+			}
+		}
+		t.cache.add(name, present...)
+		f.resolve(results, nil)
+	})
+
+	return f
+}
+
+// submitBatch queues every chunk of a bulk or multi request and calls done
+// once all of them were answered.
+func (t *Client) submitBatch(ctx context.Context, cmd string, name string, keys []string, done func([]bool, error)) {
+	chunks := t.buildChunks(cmd, name, keys)
+	resps := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var mu sync.Mutex
+	remaining := len(chunks)
+	for i, c := range chunks {
+		i := i
+		t.pipeline.submit(&pipelineRequest{
+			ctx: ctx,
+			cmd: c.cmd,
+			done: func(resp string, err error) {
+				mu.Lock()
+				resps[i], errs[i] = resp, err
+				remaining--
+				last := remaining == 0
+				mu.Unlock()
+
+				if last {
+					done(assembleChunks(len(keys), chunks, resps, errs))
+				}
+			},
+		})
+	}
+}
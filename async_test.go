@@ -0,0 +1,82 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsync(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(), WithMaxBatchKeys(3))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+
+	sets := make([]*BoolFuture, 20)
+	for i := range sets {
+		sets[i] = client.SetAsync(ctx, testFilter1, fmt.Sprintf("key-%d", i%10))
+	}
+
+	added := 0
+	for _, f := range sets {
+		<-f.Done()
+		r, err := f.Wait(ctx)
+		assert.NoError(err)
+		if r {
+			added++
+		}
+	}
+	assert.Equal(10, added)
+
+	checks := make([]*BoolFuture, 20)
+	for i := range checks {
+		checks[i] = client.CheckAsync(ctx, testFilter1, fmt.Sprintf("key-%d", i))
+	}
+	for i, f := range checks {
+		r, err := f.Wait(ctx)
+		assert.NoError(err)
+		assert.Equal(i < 10, r, i)
+	}
+
+	bulk := client.BulkAsync(ctx, testFilter1, "key-0", "a", "b", "c", "d", "e", "f")
+	multi := client.MultiAsync(ctx, testFilter1, "a", "z", "key-9", "key-99")
+
+	r, err := bulk.Wait(ctx)
+	assert.NoError(err)
+	assert.Equal([]bool{false, true, true, true, true, true, true}, r)
+
+	r, err = multi.Wait(ctx)
+	assert.NoError(err)
+	assert.Len(r, 4)
+	assert.False(r[1])
+	assert.True(r[2])
+	assert.False(r[3])
+
+	_, err = client.MultiAsync(ctx, "missing", "a").Wait(ctx)
+	assert.Equal(FilterDoesNotExist, err)
+}
+
+func TestAsyncCanceled(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = client.SetAsync(ctx, testFilter1, "key").Wait(context.Background())
+	assert.Equal(context.Canceled, err)
+
+	client.Shutdown()
+	_, err = client.CheckAsync(context.Background(), testFilter1, "key").Wait(context.Background())
+	assert.Equal(ErrClientShutdown, err)
+}
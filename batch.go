@@ -0,0 +1,190 @@
+package bloomd
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// chunk is a single bulk or multi command covering a contiguous range of the
+// requested keys.
+type chunk struct {
+	cmd    string
+	offset int
+	n      int
+}
+
+// sendBatch sends a bulk or multi request, splitting it into chunks according
+// to the configured limits. The results are returned in the order of the keys.
+// If any chunk fails no results are returned.
+func (t *Client) sendBatch(ctx context.Context, cmd string, name string, keys []string) ([]bool, error) {
+	chunks := t.buildChunks(cmd, name, keys)
+	if len(chunks) == 1 {
+		resp, err := t.sendCommand(ctx, chunks[0].cmd)
+		if err != nil {
+			return nil, err
+		}
+		return parseBoolList(chunks[0].n, resp)
+	}
+
+	var resps []string
+	var errs []error
+	if t.pipelining {
+		resps, errs = t.sendChunksPipelined(ctx, chunks)
+	} else {
+		resps, errs = t.sendChunksConcurrently(ctx, chunks)
+	}
+
+	return assembleChunks(len(keys), chunks, resps, errs)
+}
+
+// assembleChunks parses the chunk responses back into a single result in the
+// order of the keys. If any chunk failed a single error is returned, which is
+// left unwrapped when there was only one chunk.
+func assembleChunks(n int, chunks []chunk, resps []string, errs []error) ([]bool, error) {
+	results := make([]bool, n)
+	failed := 0
+	var firstErr error
+	for i, c := range chunks {
+		err := errs[i]
+		if err == nil {
+			var r []bool
+			if r, err = parseBoolList(c.n, resps[i]); err == nil {
+				copy(results[c.offset:c.offset+c.n], r)
+			}
+		}
+
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if failed > 0 && len(chunks) == 1 {
+		return nil, firstErr
+	} else if failed > 0 {
+		return nil, errors.Wrapf(firstErr, "bloomd: %d of %d chunks failed", failed, len(chunks))
+	}
+
+	return results, nil
+}
+
+// sendChunksPipelined sends every chunk over a single connection.
+func (t *Client) sendChunksPipelined(ctx context.Context, chunks []chunk) ([]string, []error) {
+	cmds := make([]string, len(chunks))
+	for i, c := range chunks {
+		cmds[i] = c.cmd
+	}
+
+	errs := make([]error, len(chunks))
+	resps, err := t.sendPipeline(ctx, cmds)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	return resps, errs
+}
+
+// sendChunksConcurrently sends every chunk on its own connection from the pool.
+func (t *Client) sendChunksConcurrently(ctx context.Context, chunks []chunk) ([]string, []error) {
+	resps := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i], errs[i] = t.sendCommand(ctx, chunks[i].cmd)
+		}(i)
+	}
+	wg.Wait()
+
+	return resps, errs
+}
+
+// buildChunks splits the keys into commands that respect the maximum number
+// of keys and line length configured for the client.
+func (t *Client) buildChunks(cmd string, name string, keys []string) []chunk {
+	return splitChunks(cmd, name, keys, t.hashKey, t.maxBatchKeys, t.maxLineBytes)
+}
+
+// splitChunks splits the keys into commands of at most maxKeys keys and
+// maxBytes bytes, including the trailing newline. A key that does not fit in a
+// line on its own is still sent, alone, and left for bloomD to reject.
+func splitChunks(cmd string, name string, keys []string, hash func(string) string, maxKeys int, maxBytes int) []chunk {
+	prefixLen := len(cmd) + 1 + len(name)
+
+	chunks := []chunk{}
+	bldr := &strings.Builder{}
+	start := 0
+	for i, key := range keys {
+		hashed := hash(key)
+		n := i - start
+
+		full := n > 0 && maxKeys > 0 && n >= maxKeys
+		// Account for the separating space and the trailing newline.
+		tooLong := n > 0 && maxBytes > 0 && bldr.Len()+1+len(hashed)+1 > maxBytes
+		if full || tooLong {
+			chunks = append(chunks, chunk{cmd: bldr.String(), offset: start, n: n})
+			bldr = &strings.Builder{}
+			start = i
+		}
+
+		if bldr.Len() == 0 {
+			bldr.Grow(prefixLen)
+			bldr.WriteString(cmd)
+			bldr.WriteRune(' ')
+			bldr.WriteString(name)
+		}
+		bldr.WriteRune(' ')
+		bldr.WriteString(hashed)
+	}
+
+	if bldr.Len() == 0 {
+		// No keys, let bloomD reply with its usual error.
+		return []chunk{{cmd: cmd + " " + name, offset: 0, n: 0}}
+	}
+
+	return append(chunks, chunk{cmd: bldr.String(), offset: start, n: len(keys) - start})
+}
+
+// multiUnion reports whether each key is present in any of the filters. The
+// multi commands for every filter are pipelined over a single connection. A
+// missing filter counts as empty.
+func (t *Client) multiUnion(ctx context.Context, names []string, keys []string) ([]bool, error) {
+	var chunks []chunk
+	for _, name := range names {
+		chunks = append(chunks, t.buildChunks(_MULTI, name, keys)...)
+	}
+
+	cmds := make([]string, len(chunks))
+	for i, c := range chunks {
+		cmds[i] = c.cmd
+	}
+	resps, err := t.sendPipeline(ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]bool, len(keys))
+	for i, c := range chunks {
+		present, err := parseBoolList(c.n, resps[i])
+		if err == FilterDoesNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for k, p := range present {
+			results[c.offset+k] = results[c.offset+k] || p
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,94 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildChunks(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &Client{maxBatchKeys: 2}
+	chunks := client.buildChunks(_BULK, "f", []string{"a", "b", "c", "d", "e"})
+	assert.Equal([]chunk{
+		{cmd: "b f a b", offset: 0, n: 2},
+		{cmd: "b f c d", offset: 2, n: 2},
+		{cmd: "b f e", offset: 4, n: 1},
+	}, chunks)
+
+	// "m f aaa bbb\n" is 12 bytes.
+	client = &Client{maxLineBytes: 12}
+	chunks = client.buildChunks(_MULTI, "f", []string{"aaa", "bbb", "ccc", "dddddddddddd"})
+	assert.Equal([]chunk{
+		{cmd: "m f aaa bbb", offset: 0, n: 2},
+		{cmd: "m f ccc", offset: 2, n: 1},
+		{cmd: "m f dddddddddddd", offset: 3, n: 1},
+	}, chunks)
+
+	client = &Client{}
+	chunks = client.buildChunks(_MULTI, "f", []string{"a", "b", "c"})
+	assert.Equal([]chunk{{cmd: "m f a b c", offset: 0, n: 3}}, chunks)
+}
+
+func TestChunkedBulkAndMulti(t *testing.T) {
+	for _, pipelining := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pipelining=%t", pipelining), func(t *testing.T) {
+			assert := assert.New(t)
+			server := newFakeBloomd(t)
+			server.SetMaxLine(64)
+
+			client, err := NewClient(server.Addr(), WithMaxBatchKeys(7), WithMaxLineBytes(64), WithPipelining(pipelining))
+			assert.NoError(err)
+			defer client.Shutdown()
+
+			ctx := context.Background()
+			assert.NoError(client.Create(ctx, testFilter1))
+
+			keys := make([]string, 100)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key-%d", i)
+			}
+
+			r, err := client.Bulk(ctx, testFilter1, keys[:50]...)
+			assert.NoError(err)
+			assert.Len(r, 50)
+			for i := range r {
+				assert.True(r[i])
+			}
+
+			r, err = client.Multi(ctx, testFilter1, keys...)
+			assert.NoError(err)
+			assert.Len(r, 100)
+			for i := range r {
+				assert.Equal(i < 50, r[i], keys[i])
+			}
+
+			for _, cmd := range server.Commands() {
+				assert.True(len(cmd)+1 <= 64, cmd)
+				assert.True(len(strings.Fields(cmd)) <= 9, cmd)
+			}
+		})
+	}
+}
+
+func TestChunkedPartialFailure(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+	server.SetMaxLine(16)
+
+	client, err := NewClient(server.Addr(), WithMaxLineBytes(16))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, "f"))
+
+	r, err := client.Bulk(ctx, "f", "a", strings.Repeat("b", 32), "c")
+	assert.Error(err)
+	assert.Nil(r)
+	assert.Contains(err.Error(), "1 of 3 chunks failed")
+}
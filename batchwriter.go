@@ -0,0 +1,210 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFlushSize     = 100
+	defaultFlushInterval = 10 * time.Millisecond
+	defaultFlushTimeout  = 5 * time.Second
+)
+
+// BatchWriterOption is configuration setting for the BatchWriter.
+type BatchWriterOption func(*batchWriterOptions)
+
+type batchWriterOptions struct {
+	flushInterval time.Duration
+	flushSize     int
+	flushTimeout  time.Duration
+}
+
+// WithFlushSize sets the number of keys pending for a filter that triggers a
+// flush of that filter.
+func WithFlushSize(flushSize int) BatchWriterOption {
+	return func(o *batchWriterOptions) {
+		o.flushSize = flushSize
+	}
+}
+
+// WithFlushInterval sets how often every pending key is flushed, regardless of
+// the batch size.
+func WithFlushInterval(flushInterval time.Duration) BatchWriterOption {
+	return func(o *batchWriterOptions) {
+		o.flushInterval = flushInterval
+	}
+}
+
+// WithFlushTimeout bounds how long a single bulk command may take.
+func WithFlushTimeout(flushTimeout time.Duration) BatchWriterOption {
+	return func(o *batchWriterOptions) {
+		o.flushTimeout = flushTimeout
+	}
+}
+
+// BatchWriter coalesces individual sets for the same filter into bulk
+// commands. It is safe for concurrent use.
+type BatchWriter struct {
+	client *Client
+	opts   batchWriterOptions
+
+	mu       sync.Mutex
+	pending  map[string]*pendingBatch
+	closed   bool
+	inflight sync.WaitGroup
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type pendingBatch struct {
+	keys    []string
+	futures []*BoolFuture
+}
+
+// NewBatchWriter returns a BatchWriter sending its bulk commands through the
+// client.
+func NewBatchWriter(client *Client, opts ...BatchWriterOption) *BatchWriter {
+	o := batchWriterOptions{
+		flushInterval: defaultFlushInterval,
+		flushSize:     defaultFlushSize,
+		flushTimeout:  defaultFlushTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &BatchWriter{
+		client:  client,
+		opts:    o,
+		pending: make(map[string]*pendingBatch),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go w.loop()
+
+	return w
+}
+
+// Set queues the key to be set in the filter. The future resolves to true if
+// the key was newly added and false if it was already present.
+func (w *BatchWriter) Set(name string, key string) *BoolFuture {
+	f := newBoolFuture()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		f.resolve(false, ErrBatchWriterClosed)
+		return f
+	}
+
+	batch, ok := w.pending[name]
+	if !ok {
+		batch = &pendingBatch{}
+		w.pending[name] = batch
+	}
+	batch.keys = append(batch.keys, key)
+	batch.futures = append(batch.futures, f)
+
+	if w.opts.flushSize > 0 && len(batch.keys) >= w.opts.flushSize {
+		delete(w.pending, name)
+		w.send(name, batch)
+	}
+
+	return f
+}
+
+// Flush sends every pending key and waits until all the bulk commands in
+// flight are done or the context is done.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	w.flushLocked()
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting new keys and flushes the pending ones. Sets issued
+// after Close resolve with ErrBatchWriterClosed.
+func (w *BatchWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mu.Unlock()
+
+	<-w.stopped
+	return w.Flush(ctx)
+}
+
+func (w *BatchWriter) loop() {
+	defer close(w.stopped)
+
+	if w.opts.flushInterval <= 0 {
+		<-w.stop
+		return
+	}
+
+	ticker := time.NewTicker(w.opts.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			w.flushLocked()
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// flushLocked sends every pending batch. Requires the lock to be held.
+func (w *BatchWriter) flushLocked() {
+	for name, batch := range w.pending {
+		delete(w.pending, name)
+		w.send(name, batch)
+	}
+}
+
+// send issues the bulk command for the batch in the background and resolves
+// its futures. Requires the lock to be held so Flush sees every send.
+func (w *BatchWriter) send(name string, batch *pendingBatch) {
+	w.inflight.Add(1)
+	go func() {
+		defer w.inflight.Done()
+
+		ctx := context.Background()
+		if w.opts.flushTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, w.opts.flushTimeout)
+			defer cancel()
+		}
+
+		results, err := w.client.Bulk(ctx, name, batch.keys...)
+		for i, f := range batch.futures {
+			if err != nil {
+				f.resolve(false, err)
+			} else {
+				f.resolve(results[i], nil)
+			}
+		}
+	}()
+}
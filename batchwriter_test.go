@@ -0,0 +1,106 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWriter(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+	_, err = client.Set(ctx, testFilter1, "key-0")
+	assert.NoError(err)
+
+	writer := NewBatchWriter(client, WithFlushSize(10), WithFlushInterval(time.Hour))
+
+	futures := make([]*BoolFuture, 25)
+	var wg sync.WaitGroup
+	for i := range futures {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			futures[i] = writer.Set(testFilter1, fmt.Sprintf("key-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.NoError(writer.Close(ctx))
+
+	for i, f := range futures {
+		select {
+		case <-f.Done():
+		default:
+			t.Fatalf("future %d not resolved after Close", i)
+		}
+
+		added, err := f.Wait(ctx)
+		assert.NoError(err)
+		assert.Equal(i != 0, added, i)
+		assert.True(server.Has(testFilter1, fmt.Sprintf("key-%d", i)))
+	}
+
+	// Fewer bulk commands than keys were needed.
+	bulks := 0
+	for _, cmd := range server.Commands() {
+		if cmd[0] == 'b' {
+			bulks++
+		}
+	}
+	assert.True(bulks <= 4, bulks)
+
+	_, err = writer.Set(testFilter1, "late").Wait(ctx)
+	assert.Equal(ErrBatchWriterClosed, err)
+}
+
+func TestBatchWriterInterval(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+
+	writer := NewBatchWriter(client, WithFlushSize(1000), WithFlushInterval(time.Millisecond))
+	defer writer.Close(ctx)
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	added, err := writer.Set(testFilter1, "key").Wait(waitCtx)
+	assert.NoError(err)
+	assert.True(added)
+}
+
+func TestBatchWriterError(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	writer := NewBatchWriter(client)
+
+	f := writer.Set("missing", "key")
+	assert.NoError(writer.Flush(ctx))
+
+	_, err = f.Wait(ctx)
+	assert.Equal(FilterDoesNotExist, err)
+	assert.NoError(writer.Close(ctx))
+}
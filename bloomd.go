@@ -7,10 +7,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-	pool "gopkg.in/fatih/pool.v2"
 )
 
 const (
@@ -35,66 +36,292 @@ const (
 	// Valid bloomD block identifiers
 	_RESPONSE_START = "START"
 	_RESPONSE_END   = "END"
-)
 
-type channelPool interface {
-	Get() (net.Conn, error)
-	Close()
-}
+	// Prefix listed by the connection health checks, matching no filter.
+	_HEALTH_CHECK_PREFIX = "__bloomd_health_check__"
+)
 
 // Client is represention of a configured client to a bloomD server.
 type Client struct {
-	pool        channelPool
-	hostname    string
-	maxAttempts int
-	hashKeys    bool
+	pool         *connPool
+	hostname     string
+	maxAttempts  int
+	hashKeys     bool
+	maxBatchKeys int
+	maxLineBytes int
+	pipelining   bool
+	coalescer    *checkCoalescer
+	cache        *positiveCache
+	pipeline     *pipeliner
+	health       *healthMonitor
+	breaker      *circuitBreaker
+	fallback     *fallback
+	local        *localFallback
+	journal      *journal
+	reprovision  *reprovisioner
+	templates    []namedTemplate
+	aliases      *aliasResolver
+	canaries     canaryChecks
+
+	readOnly         bool
+	protectedFilters []string
+	auditHandler     func(AuditEvent)
+	dryRun           *dryRun
 }
 
 // NewClient returns a new bloomD client configured according to the options
-// or using the default settings.
+// or using the default settings. The hostname is a TCP address, or the path of
+// a Unix socket when absolute or prefixed with `unix://`. Unless
+// `WithLazyConnect` is used, it fails if the initial connections cannot be
+// opened.
 func NewClient(hostname string, opts ...Option) (*Client, error) {
 	o := evaluateOptions(opts)
 
-	pool, err := pool.NewChannelPool(o.initialConnections, o.maxConnections, func() (net.Conn, error) {
-		return net.Dial("tcp", hostname)
+	for _, pattern := range o.protectedFilters {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "bloomd: invalid protected pattern %s", pattern)
+		}
+	}
+
+	var aliases *aliasResolver
+	if o.aliasStore != nil {
+		var err error
+		if aliases, err = newAliasResolver(o.aliasStore, o.aliasRefresh); err != nil {
+			return nil, err
+		}
+	}
+
+	var jrnl *journal
+	if o.journal != nil {
+		var err error
+		if jrnl, err = openJournal(*o.journal); err != nil {
+			if aliases != nil {
+				aliases.close()
+			}
+			return nil, err
+		}
+	}
+
+	health := newHealthMonitor(o.healthListener, o.reconnectMinBackoff, o.reconnectMaxBackoff)
+	dialer := newDialer(hostname, o)
+	dial := func(ctx context.Context) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx)
+		health.dialed(err)
+		return conn, err
+	}
+
+	pool := newConnPool(dial, healthCheck, poolConfig{
+		maxConns:       o.maxConnections,
+		minIdle:        o.initialConnections,
+		idleTimeout:    o.idleTimeout,
+		maxLifetime:    o.maxLifetime,
+		healthInterval: o.healthCheckInterval,
 	})
 
-	if err != nil {
-		return nil, errors.Wrap(err, "Unable to create bloomd connection")
+	reconnections := o.initialConnections
+	if reconnections < 1 {
+		reconnections = 1
+	}
+	var local *localFallback
+	if o.localFallbackKeys > 0 {
+		local = newLocalFallback(o.localFallbackKeys)
+	}
+	// A dry-run or read-only client leaves the keys waiting to be replayed to a
+	// client sending them for real.
+	replay := !o.dryRun && !o.readOnly
+	health.reconnect = func(ctx context.Context) error {
+		err := pool.fill(ctx, reconnections)
+		if err == nil && local != nil && replay {
+			local.resume()
+		}
+		if err == nil && jrnl != nil && replay {
+			jrnl.resume()
+		}
+		return err
+	}
+
+	if !o.lazyConnect {
+		if err := pool.fill(context.Background(), o.initialConnections); err != nil {
+			health.close()
+			pool.close()
+			if jrnl != nil {
+				jrnl.close()
+			}
+			if aliases != nil {
+				aliases.close()
+			}
+			return nil, errors.Wrap(err, "Unable to create bloomd connection")
+		}
+	}
+
+	client := &Client{
+		pool:         pool,
+		hostname:     hostname,
+		maxAttempts:  o.maxAttempts,
+		hashKeys:     o.hashKeys,
+		maxBatchKeys: o.maxBatchKeys,
+		maxLineBytes: o.maxLineBytes,
+		pipelining:   o.pipelining,
+		health:       health,
+		templates:    o.templates,
+		local:        local,
+		journal:      jrnl,
+		aliases:      aliases,
+
+		readOnly:         o.readOnly,
+		protectedFilters: o.protectedFilters,
+		auditHandler:     o.auditHandler,
+	}
+	if local != nil {
+		local.client = client
+	}
+	if jrnl != nil && replay {
+		jrnl.start(client)
+	}
+	if o.lazyConnect {
+		health.connect()
 	}
 
-	return &Client{
-		pool:        pool,
-		hostname:    hostname,
-		maxAttempts: o.maxAttempts,
-		hashKeys:    o.hashKeys,
-	}, nil
+	if o.reprovision {
+		client.reprovision = newReprovisioner(o.reprovisionHandler)
+	}
+	if o.breaker != nil {
+		client.breaker = newCircuitBreaker(hostname, *o.breaker)
+	}
+	if o.fallbackPolicy != FallbackError || len(o.fallbackFilters) > 0 || o.fallbackHandler != nil {
+		client.fallback = newFallback(o.fallbackPolicy, o.fallbackFilters, o.fallbackHandler)
+	}
+
+	if o.dryRun {
+		client.dryRun = newDryRun(o.dryRunHandler)
+	}
+
+	client.pipeline = newPipeliner(client, o.maxConnections)
+	if o.coalesceWindow > 0 {
+		client.coalescer = newCheckCoalescer(client, o.coalesceWindow)
+	}
+	if o.cacheEntries > 0 {
+		client.cache = newPositiveCache(o.cacheEntries, o.cacheMaxStaleness)
+	}
+
+	return client, nil
 }
 
-// Set sets a key in a filter.
+// Set sets a key in a filter. A filter with a template is created on first
+// use, see `WithFilterTemplate`. With `WithJournal` a set that fails to reach
+// bloomD returns ErrJournaled once written to the journal. With `WithAliases`
+// the key is also set in the dual-write filters of the alias.
 func (t *Client) Set(ctx context.Context, name string, key string) (bool, error) {
+	if err := t.checkWritable(); err != nil {
+		return false, err
+	}
+
+	name, dual := t.resolveWrite(name)
+	added, err := t.set(ctx, name, key)
+	if err == nil {
+		err = dualWrite(dual, func(name string) error {
+			_, err := t.set(ctx, name, key)
+			return err
+		})
+	}
+
+	return added, err
+}
+
+func (t *Client) set(ctx context.Context, name string, key string) (bool, error) {
+	added, err := t.setOnce(ctx, name, key)
+	if t.autoCreated(ctx, name, err) {
+		added, err = t.setOnce(ctx, name, key)
+	}
+
+	return added, err
+}
+
+func (t *Client) setOnce(ctx context.Context, name string, key string) (bool, error) {
 	cmd := t.buildCommand(_SET, name, key)
 	resp, err := t.sendCommand(ctx, cmd)
 	if err != nil {
-		return false, err
+		added, err := t.setOffline(name, []string{key}, err)
+		if err != nil {
+			return false, err
+		}
+		return added[0], nil
 	}
 
-	return parseBool(resp)
+	added, err := parseBool(resp)
+	if err == nil {
+		t.cacheSet(name, key)
+	}
+
+	return added, err
 }
 
-// Bulk sets many items in a filter at once.
+// Bulk sets many items in a filter at once. Requests larger than the
+// configured batch limits are split into several commands, see
+// `WithMaxBatchKeys` and `WithMaxLineBytes`. Like `Set`, it creates filters
+// with a template on first use, returns ErrJournaled when the keys were
+// journaled instead and also sets the keys in the dual-write filters of an
+// alias.
 func (t *Client) Bulk(ctx context.Context, name string, keys ...string) ([]bool, error) {
-	cmd := t.buildCommand(_BULK, name, keys...)
-	resp, err := t.sendCommand(ctx, cmd)
-	if err != nil {
+	if err := t.checkWritable(); err != nil {
 		return nil, err
 	}
 
-	return parseBoolList(len(keys), resp)
+	name, dual := t.resolveWrite(name)
+	results, err := t.bulk(ctx, name, keys)
+	if err == nil {
+		err = dualWrite(dual, func(name string) error {
+			_, err := t.bulk(ctx, name, keys)
+			return err
+		})
+	}
+
+	return results, err
+}
+
+func (t *Client) bulk(ctx context.Context, name string, keys []string) ([]bool, error) {
+	results, err := t.sendBatchReprovisioned(ctx, _BULK, name, keys)
+	if err != nil {
+		return t.setOffline(name, keys, err)
+	}
+
+	t.cacheSet(name, keys...)
+
+	return results, err
 }
 
-// Check checks if a key is in a filter.
+// Check checks if a key is in a filter. With `WithCheckCoalescing` the check
+// may be merged with other concurrent checks into a single multi command. With
+// `WithPositiveCache` keys known to be present are answered locally. When
+// bloomD cannot be reached the answer follows `WithFallbackPolicy`.
 func (t *Client) Check(ctx context.Context, name string, key string) (bool, error) {
+	name = t.resolve(name)
+	if t.cache != nil && t.cache.get(name, key) {
+		return true, nil
+	}
+
+	var present bool
+	var err error
+	if t.coalescer != nil {
+		present, err = t.coalescer.check(name, key).Wait(ctx)
+	} else {
+		present, err = t.check(ctx, name, key)
+		if t.reprovisioned(ctx, name, err) {
+			present, err = t.check(ctx, name, key)
+		}
+	}
+	if err != nil {
+		return t.checkFallback(name, key, err)
+	}
+
+	if present && t.cache != nil {
+		t.cache.add(name, key)
+	}
+
+	return present, err
+}
+
+func (t *Client) check(ctx context.Context, name string, key string) (bool, error) {
 	cmd := t.buildCommand(_CHECK, name, key)
 	resp, err := t.sendCommand(ctx, cmd)
 	if err != nil {
@@ -104,24 +331,91 @@ func (t *Client) Check(ctx context.Context, name string, key string) (bool, erro
 	return parseBool(resp)
 }
 
-// Multi checks whether multiple keys exist in the filter.
+// Multi checks whether multiple keys exist in the filter. Requests larger than
+// the configured batch limits are split into several commands, see
+// `WithMaxBatchKeys` and `WithMaxLineBytes`. With `WithPositiveCache` only the
+// keys not known to be present are sent. When bloomD cannot be reached the
+// answer follows `WithFallbackPolicy`.
 func (t *Client) Multi(ctx context.Context, name string, keys ...string) ([]bool, error) {
-	cmd := t.buildCommand(_MULTI, name, keys...)
-	resp, err := t.sendCommand(ctx, cmd)
+	return t.multi(ctx, t.resolve(name), keys)
+}
+
+func (t *Client) multi(ctx context.Context, name string, keys []string) ([]bool, error) {
+	if t.cache == nil {
+		results, err := t.sendBatchReprovisioned(ctx, _MULTI, name, keys)
+		if err != nil {
+			return t.multiFallback(name, keys, err)
+		}
+		return results, nil
+	}
+
+	results := make([]bool, len(keys))
+	missing := make([]int, 0, len(keys))
+	for i, key := range keys {
+		if t.cache.get(name, key) {
+			results[i] = true
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	missingKeys := make([]string, len(missing))
+	for i, idx := range missing {
+		missingKeys[i] = keys[idx]
+	}
+
+	fetched, err := t.sendBatchReprovisioned(ctx, _MULTI, name, missingKeys)
 	if err != nil {
-		return nil, err
+		assumed, err := t.multiFallback(name, missingKeys, err)
+		if err != nil {
+			return nil, err
+		}
+		for i, idx := range missing {
+			results[idx] = assumed[i]
+		}
+		return results, nil
+	}
+
+	present := make([]string, 0, len(missing))
+	for i, idx := range missing {
+		results[idx] = fetched[i]
+		if fetched[i] {
+			present = append(present, keys[idx])
+		}
 	}
+	t.cache.add(name, present...)
 
-	return parseBoolList(len(keys), resp)
+	return results, nil
 }
 
 // Create a new filter (a filter is a named bloom filter).
 func (t *Client) Create(ctx context.Context, name string) error {
-	return t.CreateWithParams(ctx, name, 0, 0, false)
+	target := t.resolve(name)
+	return t.admin(ctx, _CREATE, name, target, func() error {
+		return t.create(ctx, target, 0, 0, false)
+	})
 }
 
 // CreateWithParams creates a new filter with the given properties.
 func (t *Client) CreateWithParams(ctx context.Context, name string, capacity int, probability float64, inMemory bool) error {
+	target := t.resolve(name)
+	return t.admin(ctx, _CREATE, name, target, func() error {
+		return t.create(ctx, target, capacity, probability, inMemory)
+	})
+}
+
+// createFilter creates the filter itself like `dropFilter`.
+func (t *Client) createFilter(ctx context.Context, name string, capacity int, probability float64, inMemory bool) error {
+	return t.admin(ctx, _CREATE, name, name, func() error {
+		return t.create(ctx, name, capacity, probability, inMemory)
+	})
+}
+
+func (t *Client) create(ctx context.Context, name string, capacity int, probability float64, inMemory bool) error {
 	if probability > 0 && capacity < 1 {
 		return errors.New("bloomd: invalid capacity/probability")
 	}
@@ -132,11 +426,39 @@ func (t *Client) CreateWithParams(ctx context.Context, name string, capacity int
 		return err
 	}
 
-	return parseCreate(resp)
+	if err := parseCreate(resp); err != nil {
+		return err
+	}
+	t.learnFilter(name, capacity, probability)
+	if t.reprovision != nil {
+		t.reprovision.remember(name, filterParams{capacity: capacity, probability: probability, inMemory: inMemory})
+	}
+	return nil
 }
 
 // Info retrieves information about the specified filter.
 func (t *Client) Info(ctx context.Context, name string) (VerboseBloomFilter, error) {
+	return t.filterInfo(ctx, t.resolve(name))
+}
+
+// filterInfo retrieves information about the filter itself like `dropFilter`.
+func (t *Client) filterInfo(ctx context.Context, name string) (VerboseBloomFilter, error) {
+	info, err := t.info(ctx, name)
+	if t.reprovisioned(ctx, name, err) {
+		info, err = t.info(ctx, name)
+	}
+	if err != nil {
+		return VerboseBloomFilter{}, err
+	}
+
+	t.learnFilter(name, info.Capacity, float64(info.Probability))
+	if t.reprovision != nil && t.reprovision.observe(info) {
+		t.reprovision.notify(ReprovisionEvent{Filter: name, Reason: ErrFilterReset})
+	}
+	return info, nil
+}
+
+func (t *Client) info(ctx context.Context, name string) (VerboseBloomFilter, error) {
 	cmd := t.buildCommand(_INFO, name)
 	resp, err := t.sendCommand(ctx, cmd)
 	if err != nil {
@@ -146,10 +468,31 @@ func (t *Client) Info(ctx context.Context, name string) (VerboseBloomFilter, err
 	return parseInfo(name, resp)
 }
 
-// Drop permanently deletes filter.
+// Drop permanently deletes filter. Any cached results for it are forgotten.
+// A protected filter is only dropped with `OverrideProtection`.
 func (t *Client) Drop(ctx context.Context, name string) error {
+	target := t.resolve(name)
+	return t.admin(ctx, _DROP, name, target, func() error {
+		return t.drop(ctx, target)
+	})
+}
+
+// dropFilter drops the filter itself, never the target of an alias by the
+// same name, for the callers working on the filters listed by bloomD. It is
+// still audited and subject to the protected filters.
+func (t *Client) dropFilter(ctx context.Context, name string) error {
+	return t.admin(ctx, _DROP, name, name, func() error {
+		return t.drop(ctx, name)
+	})
+}
+
+func (t *Client) drop(ctx context.Context, name string) error {
 	cmd := t.buildCommand(_DROP, name)
 	resp, err := t.sendCommand(ctx, cmd)
+	t.invalidateCache(name)
+	if err == nil {
+		t.forgetFilter(name)
+	}
 	if err != nil {
 		return err
 	}
@@ -157,10 +500,22 @@ func (t *Client) Drop(ctx context.Context, name string) error {
 	return parseDropConfirmation(resp)
 }
 
-// Clear removes a items from a filter
+// Clear removes a items from a filter. Any cached results for it are forgotten.
+// A protected filter is only cleared with `OverrideProtection`.
 func (t *Client) Clear(ctx context.Context, name string) error {
+	target := t.resolve(name)
+	return t.admin(ctx, _CLEAR, name, target, func() error {
+		return t.clear(ctx, target)
+	})
+}
+
+func (t *Client) clear(ctx context.Context, name string) error {
 	cmd := t.buildCommand(_CLEAR, name)
 	resp, err := t.sendCommand(ctx, cmd)
+	t.invalidateCache(name)
+	if err == nil {
+		t.forgetFilter(name)
+	}
 	if err != nil {
 		return err
 	}
@@ -168,10 +523,26 @@ func (t *Client) Clear(ctx context.Context, name string) error {
 	return parseConfirmation(resp)
 }
 
-// Close closes a filter (Unmaps from memory, but still accessible).
+// Close closes a filter (Unmaps from memory, but still accessible). Any cached
+// results for it are forgotten.
 func (t *Client) Close(ctx context.Context, name string) error {
+	target := t.resolve(name)
+	return t.admin(ctx, _CLOSE, name, target, func() error {
+		return t.close(ctx, target)
+	})
+}
+
+// closeFilter closes the filter itself like `dropFilter`.
+func (t *Client) closeFilter(ctx context.Context, name string) error {
+	return t.admin(ctx, _CLOSE, name, name, func() error {
+		return t.close(ctx, name)
+	})
+}
+
+func (t *Client) close(ctx context.Context, name string) error {
 	cmd := t.buildCommand(_CLOSE, name)
 	resp, err := t.sendCommand(ctx, cmd)
+	t.invalidateCache(name)
 	if err != nil {
 		return err
 	}
@@ -202,7 +573,13 @@ func (t *Client) ListByPrefix(ctx context.Context, prefix string) ([]BloomFilter
 
 // Flush flushes all filters to disk.
 func (t *Client) FlushAll(ctx context.Context) error {
-	resp, err := t.sendCommand(ctx, _FLUSH)
+	return t.admin(ctx, _FLUSH, "", "", func() error {
+		return t.flush(ctx, _FLUSH)
+	})
+}
+
+func (t *Client) flush(ctx context.Context, cmd string) error {
+	resp, err := t.sendCommand(ctx, cmd)
 	if err != nil {
 		return err
 	}
@@ -212,18 +589,73 @@ func (t *Client) FlushAll(ctx context.Context) error {
 
 // Flush flushes the speficied filter to disk.
 func (t *Client) FlushFilter(ctx context.Context, name string) error {
-	cmd := t.buildCommand(_FLUSH, name)
-	resp, err := t.sendCommand(ctx, cmd)
-	if err != nil {
-		return err
+	target := t.resolve(name)
+	return t.admin(ctx, _FLUSH, name, target, func() error {
+		return t.flush(ctx, t.buildCommand(_FLUSH, target))
+	})
+}
+
+// Shutdown closes every connection in the pool. Pending asynchronous requests
+// fail with ErrClientShutdown.
+func (t *Client) Shutdown() {
+	t.pipeline.close()
+	if t.aliases != nil {
+		t.aliases.close()
+	}
+	if t.local != nil {
+		t.local.close()
 	}
+	if t.journal != nil {
+		t.journal.close()
+	}
+	t.health.close()
+	t.pool.close()
+}
 
-	return parseConfirmation(resp)
+// Health returns the current health state of the client.
+func (t *Client) Health() HealthState {
+	return t.health.current()
 }
 
-// Shutdown closes every connection in the pool.
-func (t *Client) Shutdown() {
-	t.pool.Close()
+// PoolStats returns a snapshot of the connection pool.
+func (t *Client) PoolStats() PoolStats {
+	return t.pool.snapshot()
+}
+
+// BreakerStats returns a snapshot of the circuit breaker of the server. It is
+// empty unless the client was created with `WithCircuitBreaker`.
+func (t *Client) BreakerStats() BreakerStats {
+	if t.breaker == nil {
+		return BreakerStats{Server: t.hostname}
+	}
+	return t.breaker.snapshot()
+}
+
+// FallbackStats returns the number of checks answered according to the
+// fallback policy since the client was created.
+func (t *Client) FallbackStats() FallbackStats {
+	if t.fallback == nil {
+		return FallbackStats{}
+	}
+	return t.fallback.snapshot()
+}
+
+// LocalFallbackStats returns a snapshot of the local fallback filters. It is
+// empty unless the client was created with `WithLocalFallback`.
+func (t *Client) LocalFallbackStats() LocalFallbackStats {
+	if t.local == nil {
+		return LocalFallbackStats{}
+	}
+	return t.local.snapshot()
+}
+
+// JournalStats returns a snapshot of the journal counters. It is empty unless
+// the client was created with `WithJournal`.
+func (t *Client) JournalStats() JournalStats {
+	if t.journal == nil {
+		return JournalStats{}
+	}
+	return t.journal.snapshot()
 }
 
 // Ping hits bloomD and returns an error or nil.
@@ -233,16 +665,89 @@ func (t *Client) Ping() error {
 	return err
 }
 
+// CacheStats returns a snapshot of the positive result cache counters. It is
+// empty unless the client was created with `WithPositiveCache`.
+func (t *Client) CacheStats() CacheStats {
+	if t.cache == nil {
+		return CacheStats{}
+	}
+	return t.cache.snapshot()
+}
+
+func (t *Client) invalidateCache(name string) {
+	if t.cache != nil {
+		t.cache.invalidate(name)
+	}
+}
+
+// cacheSet caches the keys just set, unless the sets were only simulated by a
+// dry run.
+func (t *Client) cacheSet(name string, keys ...string) {
+	if t.cache != nil && t.dryRun == nil {
+		t.cache.add(name, keys...)
+	}
+}
+
+// setOffline handles a set that failed to reach bloomD: the keys are written
+// to the journal, and set in the local fallback filter. Returns ErrJournaled
+// once they are in the journal.
+func (t *Client) setOffline(name string, keys []string, err error) ([]bool, error) {
+	// Simulated sets must not be replayed for real later on.
+	if !isUnavailable(err) || t.dryRun != nil {
+		return nil, err
+	}
+
+	journaled := t.journal != nil && t.journal.append(name, keys) == nil
+
+	var added []bool
+	if t.local != nil {
+		added = t.local.set(name, !journaled, keys...)
+	}
+
+	switch {
+	case journaled:
+		return nil, ErrJournaled
+	case added != nil:
+		return added, nil
+	default:
+		return nil, err
+	}
+}
+
+// forgetFilter forgets what the client knows about a filter it dropped or
+// cleared.
+func (t *Client) forgetFilter(name string) {
+	if t.local != nil {
+		t.local.forget(name)
+	}
+	if t.reprovision != nil {
+		t.reprovision.forget(name)
+	}
+}
+
+// learnFilter remembers the parameters of a filter to size its local fallback
+// filter.
+func (t *Client) learnFilter(name string, capacity int, probability float64) {
+	if t.local != nil {
+		t.local.learn(name, capacity, probability)
+	}
+}
+
 // Returns the key the client will send to the server, maybe hashing it.
 func (t *Client) hashKey(key string) string {
 	if t.hashKeys {
-		h := sha1.New()
-		io.WriteString(h, key)
-		return fmt.Sprintf("%x", h.Sum(nil))
+		return sha1Key(key)
 	}
 	return key
 }
 
+// sha1Key returns the hex encoded SHA-1 of the key.
+func sha1Key(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 func (t *Client) buildCommand(cmd string, arg string, keys ...string) string {
 	bldr := &strings.Builder{}
 	bldr.WriteString(cmd)
@@ -279,43 +784,131 @@ func (t *Client) buildCreateCommand(name string, capacity int, probability float
 
 // sendCommand sends the command asynchronously to bloomD. Returns the parsed response.
 func (t *Client) sendCommand(ctx context.Context, cmd string) (string, error) {
-	var conn net.Conn
-	var err error
-	var line string
+	resps, err := t.sendPipeline(ctx, []string{cmd})
+	if err != nil {
+		return "", err
+	}
 
-	errCh := make(chan error, 1)
+	return resps[0], nil
+}
 
-	go func() {
-		errCh <- func() error {
-			conn, err = t.pool.Get()
-			if err != nil {
-				return err
-			}
-			defer conn.Close()
+// sendPipeline writes all the commands to a single connection before reading
+// any of the responses. Returns the parsed responses in the same order as the
+// commands.
+func (t *Client) sendPipeline(ctx context.Context, cmds []string) ([]string, error) {
+	if t.dryRun != nil {
+		return t.dryRun.sendPipeline(ctx, cmds, t.sendLive)
+	}
+	return t.sendLive(ctx, cmds)
+}
 
-			if err = send(conn, cmd, t.maxAttempts); err != nil {
-				return checkConnectionError(conn, err)
-			}
+// sendLive sends the commands as they are, through the circuit breaker.
+func (t *Client) sendLive(ctx context.Context, cmds []string) ([]string, error) {
+	var trial bool
+	if t.breaker != nil {
+		var err error
+		if trial, err = t.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
 
-			line, err = recv(conn)
-			if err != nil {
-				return checkConnectionError(conn, err)
-			}
+	lines, err := t.roundTripPooled(ctx, cmds)
+	if err == nil && t.local != nil {
+		t.local.resume()
+	}
+	if err == nil && t.journal != nil {
+		t.journal.resume()
+	}
 
-			return nil
+	if t.breaker != nil {
+		if errors.Cause(err) == context.Canceled {
+			t.breaker.abandon(trial)
+		} else {
+			t.breaker.record(trial, isUnavailable(err))
+		}
+	}
+
+	return lines, err
+}
+
+// roundTripPooled runs the commands over a connection from the pool.
+func (t *Client) roundTripPooled(ctx context.Context, cmds []string) ([]string, error) {
+	conn, err := t.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := exchange(ctx, conn, cmds, t.maxAttempts)
+	t.pool.put(conn, err)
+	if ctx.Err() == nil {
+		t.health.requested(err)
+	}
+
+	return lines, err
+}
+
+// exchange writes the commands and reads their responses. The connection
+// deadline is bound to the context, so a done context interrupts blocked
+// reads and writes.
+func exchange(ctx context.Context, conn net.Conn, cmds []string, maxAttempts int) ([]string, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	if ctx.Done() != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.SetDeadline(time.Unix(1, 0))
+			case <-finished:
+			}
 		}()
-	}()
+	}
 
-	select {
-	case err := <-errCh:
-		if err != nil {
-			return "", checkConnectionError(conn, err)
+	lines, err := roundTrip(conn, cmds, maxAttempts)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return lines, err
+}
+
+// roundTrip writes the commands and reads their responses.
+func roundTrip(conn net.Conn, cmds []string, maxAttempts int) ([]string, error) {
+	if err := send(conn, strings.Join(cmds, "\n"), maxAttempts); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	lines := make([]string, len(cmds))
+	for i := range cmds {
+		var err error
+		if lines[i], err = recv(reader); err != nil {
+			return nil, err
 		}
-		return line, nil
+	}
 
-	case <-ctx.Done():
-		return "", checkConnectionError(conn, ctx.Err())
+	return lines, nil
+}
+
+// defaultHealthCheckTimeout bounds a single connection health check.
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// healthCheck sends a cheap list command over the connection.
+func healthCheck(conn net.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultHealthCheckTimeout)
+	defer cancel()
+
+	lines, err := exchange(ctx, conn, []string{_LIST + " " + _HEALTH_CHECK_PREFIX}, 1)
+	if err != nil {
+		return err
 	}
+
+	_, err = parseFilterList(lines[0])
+	return err
 }
 
 // send writes the request to bloomD. Retrying as necessary.
@@ -333,10 +926,10 @@ func send(w io.Writer, cmd string, maxAttempts int) error {
 	return errors.Wrap(err, "bloomd: unable to write to connection")
 }
 
-// recv retrieves the response from bloomD.
-func recv(r io.Reader) (string, error) {
+// recv retrieves a single, possibly multi-line, response from bloomD. The
+// reader is shared across pipelined responses so nothing buffered is lost.
+func recv(reader *bufio.Reader) (string, error) {
 	bldr := &strings.Builder{}
-	reader := bufio.NewReader(r)
 
 	txt, err := reader.ReadString('\n')
 	if err != nil {
@@ -367,15 +960,3 @@ func recv(r io.Reader) (string, error) {
 
 	return responseString, nil
 }
-
-func checkConnectionError(conn net.Conn, err error) error {
-	if conn == nil {
-		return err
-	}
-
-	if pconn, ok := conn.(*pool.PoolConn); ok {
-		pconn.MarkUnusable()
-	}
-
-	return err
-}
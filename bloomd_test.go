@@ -9,7 +9,8 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-// NOTE: Requires bloomd to be available as `bloomd`
+// NOTE: Uses bloomd when it is available as `bloomd`, otherwise falls back to
+// the in-process fake server.
 
 const (
 	testBloomdHost = "localhost:8673"
@@ -17,7 +18,10 @@ const (
 	testFilter2    = "test_filter_2"
 )
 
-var bloomd *exec.Cmd
+var (
+	bloomd     *exec.Cmd
+	fakeServer *fakeBloomd
+)
 
 func TestNewClient(t *testing.T) {
 	assert := assert.New(t)
@@ -92,12 +96,23 @@ func TestGetSetGet(t *testing.T) {
 }
 
 func startBloomdServer() {
+	if _, err := exec.LookPath("bloomd"); err != nil {
+		fakeServer, _ = startFakeBloomd(testBloomdHost)
+		return
+	}
+
 	bloomd = exec.Command("bloomd")
 	bloomd.Start()
 	time.Sleep(time.Millisecond * 10)
 }
 
 func killBloomdServer() {
+	if fakeServer != nil {
+		fakeServer.Close()
+		fakeServer = nil
+		return
+	}
+
 	bloomd.Process.Kill()
 	time.Sleep(time.Millisecond * 10)
 }
@@ -0,0 +1,262 @@
+package bloomd
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerOpenTimeout      = 5 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+	defaultBreakerWindow           = 10 * time.Second
+)
+
+// BreakerState is the state of the circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every request with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a few trial requests through to decide whether to
+	// close or open again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig configures the circuit breaker. The breaker trips when
+// either threshold is reached, a zero threshold is disabled.
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures trips the breaker after this many failed requests
+	// in a row.
+	ConsecutiveFailures int
+	// FailureRate trips the breaker once the fraction of failed requests in
+	// the current window reaches it, given at least MinRequests requests.
+	FailureRate float64
+	MinRequests int
+	// Window is the length of the window the failure rate is computed over.
+	// Defaults to 10s.
+	Window time.Duration
+	// OpenTimeout is how long the breaker stays open before letting trial
+	// requests through. Defaults to 5s.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of trial requests that must succeed to
+	// close the breaker. Defaults to 1.
+	HalfOpenRequests int
+	// OnStateChange, if set, is called with the server address on every
+	// state change.
+	OnStateChange func(server string, from, to BreakerState)
+}
+
+// BreakerStats is a snapshot of the circuit breaker of a server.
+type BreakerStats struct {
+	Server   string
+	State    BreakerState
+	Requests int64
+	Failures int64
+	Rejected int64
+	Trips    int64
+}
+
+// circuitBreaker fails requests fast while the server keeps failing. Only
+// failures to reach the server count, error replies do not.
+type circuitBreaker struct {
+	server string
+	cfg    CircuitBreakerConfig
+
+	mu             sync.Mutex
+	state          BreakerState
+	openedAt       time.Time
+	consecutive    int
+	windowStart    time.Time
+	windowRequests int
+	windowFailures int
+	trials         int
+	trialSuccesses int
+	stats          BreakerStats
+	transitions    [][2]BreakerState
+
+	// Held while notifying so the callback sees transitions in order.
+	notifyMu sync.Mutex
+}
+
+func newCircuitBreaker(server string, cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultBreakerWindow
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+
+	return &circuitBreaker{
+		server:      server,
+		cfg:         cfg,
+		windowStart: time.Now(),
+	}
+}
+
+// allow reports whether a request may go through. Trial requests let through
+// while half open must be followed by a call to record.
+func (b *circuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+		b.trials = 0
+		b.trialSuccesses = 0
+		b.setStateLocked(BreakerHalfOpen)
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		b.stats.Rejected++
+		b.unlock()
+		return false, ErrCircuitOpen
+
+	case BreakerHalfOpen:
+		if b.trials >= b.cfg.HalfOpenRequests {
+			b.stats.Rejected++
+			b.unlock()
+			return false, ErrCircuitOpen
+		}
+		b.trials++
+		b.unlock()
+		return true, nil
+	}
+
+	b.unlock()
+	return false, nil
+}
+
+// record accounts for the outcome of a request let through by allow.
+func (b *circuitBreaker) record(trial bool, failed bool) {
+	b.mu.Lock()
+
+	b.stats.Requests++
+	if failed {
+		b.stats.Failures++
+	}
+
+	if b.state == BreakerHalfOpen {
+		if !trial {
+			b.unlock()
+			return
+		}
+
+		if failed {
+			b.tripLocked()
+		} else if b.trialSuccesses++; b.trialSuccesses >= b.cfg.HalfOpenRequests {
+			b.resetLocked()
+			b.setStateLocked(BreakerClosed)
+		}
+		b.unlock()
+		return
+	}
+
+	if b.state != BreakerClosed {
+		b.unlock()
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.windowStart) >= b.cfg.Window {
+		b.windowStart = now
+		b.windowRequests = 0
+		b.windowFailures = 0
+	}
+
+	b.windowRequests++
+	if failed {
+		b.consecutive++
+		b.windowFailures++
+	} else {
+		b.consecutive = 0
+	}
+
+	tooManyInARow := b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures
+	tooHighRate := b.cfg.FailureRate > 0 && b.windowRequests >= b.cfg.MinRequests &&
+		float64(b.windowFailures)/float64(b.windowRequests) >= b.cfg.FailureRate
+	if failed && (tooManyInARow || tooHighRate) {
+		b.tripLocked()
+	}
+
+	b.unlock()
+}
+
+// abandon gives back the slot of a request let through by allow whose outcome
+// says nothing about the server, e.g. canceled by the caller.
+func (b *circuitBreaker) abandon(trial bool) {
+	b.mu.Lock()
+	if trial && b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+	b.unlock()
+}
+
+func (b *circuitBreaker) snapshot() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Server = b.server
+	stats.State = b.state
+	return stats
+}
+
+func (b *circuitBreaker) tripLocked() {
+	b.openedAt = time.Now()
+	b.stats.Trips++
+	b.resetLocked()
+	b.setStateLocked(BreakerOpen)
+}
+
+func (b *circuitBreaker) resetLocked() {
+	b.consecutive = 0
+	b.windowStart = time.Now()
+	b.windowRequests = 0
+	b.windowFailures = 0
+}
+
+// setStateLocked changes the state. The callback is notified once the lock is
+// released.
+func (b *circuitBreaker) setStateLocked(to BreakerState) {
+	from := b.state
+	b.state = to
+	if b.cfg.OnStateChange != nil && from != to {
+		b.transitions = append(b.transitions, [2]BreakerState{from, to})
+	}
+}
+
+// unlock releases the lock and notifies the callback of the state changes
+// made while holding it.
+func (b *circuitBreaker) unlock() {
+	transitions := b.transitions
+	b.transitions = nil
+	if len(transitions) == 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	b.notifyMu.Lock()
+	b.mu.Unlock()
+	defer b.notifyMu.Unlock()
+
+	for _, t := range transitions {
+		b.cfg.OnStateChange(b.server, t[0], t[1])
+	}
+}
@@ -0,0 +1,145 @@
+package bloomd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var states []BreakerState
+	breaker := newCircuitBreaker("server", CircuitBreakerConfig{
+		ConsecutiveFailures: 2,
+		OpenTimeout:         5 * time.Millisecond,
+		HalfOpenRequests:    2,
+		OnStateChange: func(server string, from, to BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal("server", server)
+			states = append(states, to)
+		},
+	})
+
+	for _, failed := range []bool{true, false, true, true} {
+		trial, err := breaker.allow()
+		assert.NoError(err)
+		assert.False(trial)
+		breaker.record(trial, failed)
+	}
+
+	_, err := breaker.allow()
+	assert.Equal(ErrCircuitOpen, err)
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Two trials are let through, the third request is rejected.
+	trial1, err := breaker.allow()
+	assert.NoError(err)
+	assert.True(trial1)
+	trial2, err := breaker.allow()
+	assert.NoError(err)
+	_, err = breaker.allow()
+	assert.Equal(ErrCircuitOpen, err)
+
+	breaker.record(trial1, false)
+	assert.Equal(BreakerHalfOpen, breaker.snapshot().State)
+	breaker.record(trial2, false)
+	assert.Equal(BreakerClosed, breaker.snapshot().State)
+
+	stats := breaker.snapshot()
+	assert.Equal(int64(6), stats.Requests)
+	assert.Equal(int64(3), stats.Failures)
+	assert.Equal(int64(2), stats.Rejected)
+	assert.Equal(int64(1), stats.Trips)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}, states)
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	assert := assert.New(t)
+
+	breaker := newCircuitBreaker("server", CircuitBreakerConfig{
+		FailureRate: 0.5,
+		MinRequests: 4,
+		OpenTimeout: time.Millisecond,
+	})
+
+	for _, failed := range []bool{true, false, true} {
+		trial, _ := breaker.allow()
+		breaker.record(trial, failed)
+	}
+	assert.Equal(BreakerClosed, breaker.snapshot().State)
+
+	trial, _ := breaker.allow()
+	breaker.record(trial, true)
+	assert.Equal(BreakerOpen, breaker.snapshot().State)
+
+	time.Sleep(5 * time.Millisecond)
+	trial, err := breaker.allow()
+	assert.NoError(err)
+	breaker.record(trial, true)
+	assert.Equal(BreakerOpen, breaker.snapshot().State)
+	assert.Equal(int64(2), breaker.snapshot().Trips)
+}
+
+func TestIsUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(isUnavailable(nil))
+	assert.False(isUnavailable(FilterDoesNotExist))
+	assert.False(isUnavailable(errors.New("Client Error: Bad arguments")))
+	assert.False(isUnavailable(context.Canceled))
+	assert.True(isUnavailable(ErrCircuitOpen))
+	assert.True(isUnavailable(io.EOF))
+	assert.True(isUnavailable(context.DeadlineExceeded))
+
+	_, err := NewClient(freeAddr(t))
+	assert.True(isUnavailable(err))
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	addr := freeAddr(t)
+
+	client, err := NewClient(addr, WithLazyConnect(true), WithCircuitBreaker(CircuitBreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         20 * time.Millisecond,
+	}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	for i := 0; i < 3; i++ {
+		err := client.Ping()
+		assert.Error(err)
+		assert.NotEqual(ErrCircuitOpen, err)
+	}
+	assert.Equal(ErrCircuitOpen, client.Ping())
+
+	stats := client.BreakerStats()
+	assert.Equal(addr, stats.Server)
+	assert.Equal(BreakerOpen, stats.State)
+	assert.Equal(int64(1), stats.Rejected)
+
+	server, err := startFakeBloomd(addr)
+	assert.NoError(err)
+	defer server.Close()
+
+	// Error replies do not count as failures.
+	_, err = client.Info(context.Background(), "missing")
+	assert.Equal(ErrCircuitOpen, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = client.Info(context.Background(), "missing")
+	assert.Error(err)
+	assert.NotEqual(ErrCircuitOpen, err)
+	assert.Equal(BreakerClosed, client.BreakerStats().State)
+}
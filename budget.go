@@ -0,0 +1,323 @@
+package bloomd
+
+import (
+	"context"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBudgetDecay    = 0.5
+	defaultBudgetInterval = time.Minute
+	defaultBudgetTimeout  = time.Minute
+)
+
+// FilterActivity is the recent activity of a filter, as ranked by the
+// MemoryBudget.
+type FilterActivity struct {
+	Name    string
+	Storage int
+	// Activity is the decayed number of checks and sets seen between polls.
+	Activity float64
+	// Mapped reports whether the filter is believed to be mapped in memory.
+	// Filters are unmapped once closed, until used again.
+	Mapped bool
+	Pinned bool
+}
+
+// BudgetStats is a snapshot of the MemoryBudget as of its last poll.
+type BudgetStats struct {
+	Budget int64
+	// Mapped is the total storage of the filters believed to be mapped.
+	Mapped int64
+	// Closes is the number of filters closed to fit the budget.
+	Closes int64
+	// Errors is the number of polls or closes that failed.
+	Errors int64
+	// Filters is the activity of every filter, hottest first.
+	Filters []FilterActivity
+}
+
+// BudgetOption is configuration setting for the MemoryBudget.
+type BudgetOption func(*budgetOptions)
+
+type budgetOptions struct {
+	decay    float64
+	interval time.Duration
+	pinned   []string
+}
+
+// WithBudgetDecay sets the weight the activity of the previous polls keeps
+// against the latest one, between 0 and 1. Defaults to 0.5.
+func WithBudgetDecay(decay float64) BudgetOption {
+	return func(o *budgetOptions) {
+		o.decay = decay
+	}
+}
+
+// WithBudgetInterval sets how often the filters are polled. Zero or less
+// disables the background polls, leaving them to `Balance`. Defaults to a
+// minute.
+func WithBudgetInterval(interval time.Duration) BudgetOption {
+	return func(o *budgetOptions) {
+		o.interval = interval
+	}
+}
+
+// WithBudgetPinned marks the filters that are never closed, by name or
+// `path.Match` pattern.
+func WithBudgetPinned(patterns ...string) BudgetOption {
+	return func(o *budgetOptions) {
+		pinned := make([]string, len(o.pinned), len(o.pinned)+len(patterns))
+		copy(pinned, o.pinned)
+		o.pinned = append(pinned, patterns...)
+	}
+}
+
+// MemoryBudget keeps the storage bloomD maps in memory within a budget. It
+// polls the filter sizes and counters, ranks the filters by recent activity
+// and closes the coldest ones until the mapped storage fits. bloomD maps a
+// closed filter again once it is used. It is safe for concurrent use.
+type MemoryBudget struct {
+	client *Client
+	budget int64
+	opts   budgetOptions
+
+	mu      sync.Mutex
+	filters map[string]*budgetFilter
+	stats   BudgetStats
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// budgetFilter tracks a filter between polls.
+type budgetFilter struct {
+	storage  int
+	activity float64
+	counters int
+	canaries int
+	pageIns  int
+	mapped   bool
+	pinned   bool
+}
+
+// NewMemoryBudget returns a MemoryBudget keeping the mapped storage within
+// the budget in bytes, polling the filters in the background.
+func NewMemoryBudget(client *Client, budget int64, opts ...BudgetOption) (*MemoryBudget, error) {
+	o := budgetOptions{
+		decay:    defaultBudgetDecay,
+		interval: defaultBudgetInterval,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if budget < 1 || o.decay < 0 || o.decay > 1 {
+		return nil, errors.New("bloomd: invalid memory budget/decay")
+	}
+	for _, pattern := range o.pinned {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "bloomd: invalid pinned pattern %s", pattern)
+		}
+	}
+
+	m := &MemoryBudget{
+		client:  client,
+		budget:  budget,
+		opts:    o,
+		filters: make(map[string]*budgetFilter),
+		stats:   BudgetStats{Budget: budget},
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go m.loop()
+
+	return m, nil
+}
+
+// Balance polls the filters once and closes the coldest ones until the mapped
+// storage fits the budget. It runs in the background unless disabled with
+// `WithBudgetInterval`.
+func (m *MemoryBudget) Balance(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.poll(ctx); err != nil {
+		m.stats.Errors++
+		return err
+	}
+
+	var mapped int64
+	var candidates []string
+	for name, f := range m.filters {
+		if !f.mapped {
+			continue
+		}
+		mapped += int64(f.storage)
+		if !f.pinned {
+			candidates = append(candidates, name)
+		}
+	}
+
+	// Coldest first, and the largest first among equally cold filters.
+	sort.Slice(candidates, func(i, k int) bool {
+		a, b := m.filters[candidates[i]], m.filters[candidates[k]]
+		if a.activity != b.activity {
+			return a.activity < b.activity
+		}
+		if a.storage != b.storage {
+			return a.storage > b.storage
+		}
+		return candidates[i] < candidates[k]
+	})
+
+	var firstErr error
+	for _, name := range candidates {
+		if mapped <= m.budget {
+			break
+		}
+		if err := m.client.closeFilter(ctx, name); err != nil && err != FilterDoesNotExist {
+			m.stats.Errors++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		f := m.filters[name]
+		f.mapped = false
+		mapped -= int64(f.storage)
+		m.stats.Closes++
+	}
+
+	m.stats.Mapped = mapped
+	return firstErr
+}
+
+// poll refreshes the storage and activity of every filter.
+func (m *MemoryBudget) poll(ctx context.Context) error {
+	filters, err := m.client.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(filters))
+	for _, filter := range filters {
+		info, err := m.client.filterInfo(ctx, filter.Name)
+		if err == FilterDoesNotExist {
+			continue
+		} else if err != nil {
+			return err
+		}
+		seen[filter.Name] = true
+
+		counters := info.Checks + info.Sets
+		canaries := m.client.canaries.get(filter.Name)
+		f, ok := m.filters[filter.Name]
+		if !ok {
+			// Unknown filters are assumed mapped, with no recent activity.
+			f = &budgetFilter{counters: counters, canaries: canaries, pageIns: info.PageIns, mapped: true}
+			m.filters[filter.Name] = f
+		}
+
+		// Counters going backwards mean bloomD restarted.
+		delta := counters - f.counters
+		if delta < 0 {
+			delta = counters
+		}
+		// Canary probes map the filter in, but are not activity.
+		probes := canaries - f.canaries
+		if delta > 0 || probes > 0 || info.PageIns != f.pageIns {
+			f.mapped = true
+		}
+		if delta -= probes; delta < 0 {
+			delta = 0
+		}
+
+		f.activity = f.activity*m.opts.decay + float64(delta)
+		f.counters = counters
+		f.canaries = canaries
+		f.pageIns = info.PageIns
+		f.storage = filter.Storage
+		f.pinned = m.pinned(filter.Name)
+	}
+
+	for name := range m.filters {
+		if !seen[name] {
+			delete(m.filters, name)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryBudget) pinned(name string) bool {
+	for _, pattern := range m.opts.pinned {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns a snapshot as of the last poll.
+func (m *MemoryBudget) Stats() BudgetStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Filters = make([]FilterActivity, 0, len(m.filters))
+	for name, f := range m.filters {
+		stats.Filters = append(stats.Filters, FilterActivity{
+			Name:     name,
+			Storage:  f.storage,
+			Activity: f.activity,
+			Mapped:   f.mapped,
+			Pinned:   f.pinned,
+		})
+	}
+	sort.Slice(stats.Filters, func(i, k int) bool {
+		if stats.Filters[i].Activity != stats.Filters[k].Activity {
+			return stats.Filters[i].Activity > stats.Filters[k].Activity
+		}
+		return stats.Filters[i].Name < stats.Filters[k].Name
+	})
+	return stats
+}
+
+// Close stops the background polls. Closed filters are left as they are.
+func (m *MemoryBudget) Close() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+	<-m.stopped
+}
+
+func (m *MemoryBudget) loop() {
+	defer close(m.stopped)
+
+	if m.opts.interval <= 0 {
+		<-m.stop
+		return
+	}
+
+	ticker := time.NewTicker(m.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultBudgetTimeout)
+			m.Balance(ctx)
+			cancel()
+		case <-m.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package bloomd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	// The fake server reports three bytes of storage per unit of capacity.
+	assert.NoError(client.CreateWithParams(ctx, "a", 1000, 0.01, false))
+	assert.NoError(client.CreateWithParams(ctx, "b", 2000, 0.01, false))
+	assert.NoError(client.CreateWithParams(ctx, "c", 1000, 0.01, false))
+	assert.NoError(client.CreateWithParams(ctx, "pinned-1", 1000, 0.01, false))
+
+	m, err := NewMemoryBudget(client, 8000, WithBudgetPinned("pinned-*"), WithBudgetInterval(0))
+	assert.NoError(err)
+	defer m.Close()
+
+	// Equally cold filters are closed largest first.
+	assert.NoError(m.Balance(ctx))
+	stats := m.Stats()
+	assert.Equal(int64(6000), stats.Mapped)
+	assert.Equal(int64(2), stats.Closes)
+	assert.Contains(server.Commands(), "close b")
+	assert.Contains(server.Commands(), "close a")
+
+	// Using a closed filter maps it again, and the coldest one is closed.
+	_, err = client.Bulk(ctx, "c", "x", "y")
+	assert.NoError(err)
+	_, err = client.Check(ctx, "a", "x")
+	assert.NoError(err)
+	_, err = client.Check(ctx, "pinned-1", "x")
+	assert.NoError(err)
+
+	assert.NoError(m.Balance(ctx))
+	stats = m.Stats()
+	assert.Equal(int64(6000), stats.Mapped)
+	assert.Equal(int64(3), stats.Closes)
+	assert.Equal([]FilterActivity{
+		{Name: "c", Storage: 3000, Activity: 2, Mapped: true},
+		{Name: "a", Storage: 3000, Activity: 1},
+		{Name: "pinned-1", Storage: 3000, Activity: 1, Mapped: true, Pinned: true},
+		{Name: "b", Storage: 6000},
+	}, stats.Filters)
+
+	// Activity decays while the filters are idle.
+	assert.NoError(m.Balance(ctx))
+	assert.Equal(1.0, m.Stats().Filters[0].Activity)
+
+	_, err = NewMemoryBudget(client, 0)
+	assert.Error(err)
+	_, err = NewMemoryBudget(client, 1, WithBudgetPinned("["))
+	assert.Error(err)
+}
+
+func TestMemoryBudgetAliases(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	store := NewFileAliasStore(filepath.Join(t.TempDir(), "aliases.json"))
+	client, err := NewClient(server.Addr(), WithAliases(store))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.CreateWithParams(ctx, "users", 2000, 0.01, false))
+	assert.NoError(client.CreateWithParams(ctx, "users_v2", 1000, 0.01, false))
+	assert.NoError(client.SetAlias(ctx, "users", Alias{Target: "users_v2"}))
+
+	m, err := NewMemoryBudget(client, 3000, WithBudgetInterval(0))
+	assert.NoError(err)
+	defer m.Close()
+
+	// The listed filter is closed, not the target of the alias by the same
+	// name.
+	assert.NoError(m.Balance(ctx))
+	assert.Contains(server.Commands(), "close users")
+	assert.NotContains(server.Commands(), "close users_v2")
+	assert.Equal(int64(3000), m.Stats().Mapped)
+}
@@ -0,0 +1,127 @@
+package bloomd
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheStats is a snapshot of the positive result cache counters.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+}
+
+// HitRate returns the fraction of lookups answered by the cache.
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// positiveCache is a LRU cache of keys known to be in a filter. Since bloom
+// filter membership only changes when the filter is cleared or dropped, the
+// entries only expire to bound staleness against other clients.
+type positiveCache struct {
+	maxEntries   int
+	maxStaleness time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List
+	filters map[string]map[string]*list.Element
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	filter  string
+	key     string
+	expires time.Time
+}
+
+func newPositiveCache(maxEntries int, maxStaleness time.Duration) *positiveCache {
+	return &positiveCache{
+		maxEntries:   maxEntries,
+		maxStaleness: maxStaleness,
+		lru:          list.New(),
+		filters:      make(map[string]map[string]*list.Element),
+	}
+}
+
+// get reports whether the key is known to be in the filter.
+func (c *positiveCache) get(name string, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.filters[name][key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if c.maxStaleness <= 0 || time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			return true
+		}
+		c.removeLocked(elem)
+	}
+
+	c.stats.Misses++
+	return false
+}
+
+// add records the keys as present in the filter.
+func (c *positiveCache) add(name string, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keyElems, ok := c.filters[name]
+	if !ok {
+		keyElems = make(map[string]*list.Element)
+		c.filters[name] = keyElems
+	}
+
+	expires := time.Now().Add(c.maxStaleness)
+	for _, key := range keys {
+		if elem, ok := keyElems[key]; ok {
+			elem.Value.(*cacheEntry).expires = expires
+			c.lru.MoveToFront(elem)
+			continue
+		}
+
+		keyElems[key] = c.lru.PushFront(&cacheEntry{filter: name, key: key, expires: expires})
+		if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+			c.removeLocked(c.lru.Back())
+			c.stats.Evictions++
+		}
+	}
+}
+
+// invalidate forgets every key of the filter.
+func (c *positiveCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.filters[name] {
+		c.lru.Remove(elem)
+	}
+	delete(c.filters, name)
+}
+
+func (c *positiveCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+func (c *positiveCache) removeLocked(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	keyElems := c.filters[entry.filter]
+	delete(keyElems, entry.key)
+	if len(keyElems) == 0 {
+		delete(c.filters, entry.filter)
+	}
+}
@@ -0,0 +1,138 @@
+package bloomd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositiveCache(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newPositiveCache(2, 0)
+	cache.add("f", "a", "b")
+	assert.True(cache.get("f", "a"))
+
+	// "b" is the least recently used entry.
+	cache.add("g", "c")
+	assert.False(cache.get("f", "b"))
+	assert.True(cache.get("f", "a"))
+	assert.True(cache.get("g", "c"))
+
+	cache.invalidate("f")
+	assert.False(cache.get("f", "a"))
+	assert.True(cache.get("g", "c"))
+
+	assert.Equal(CacheStats{Hits: 4, Misses: 2, Evictions: 1, Entries: 1}, cache.snapshot())
+	assert.InDelta(4.0/6.0, cache.snapshot().HitRate(), 1e-9)
+
+	cache = newPositiveCache(10, time.Millisecond)
+	cache.add("f", "a")
+	time.Sleep(5 * time.Millisecond)
+	assert.False(cache.get("f", "a"))
+	assert.Equal(0, cache.snapshot().Entries)
+}
+
+func TestClientPositiveCache(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(), WithPositiveCache(100, time.Minute))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+	_, err = client.Bulk(ctx, testFilter1, "a", "b")
+	assert.NoError(err)
+
+	countChecks := func() int {
+		n := 0
+		for _, cmd := range server.Commands() {
+			if strings.HasPrefix(cmd, "c ") || strings.HasPrefix(cmd, "m ") {
+				n++
+			}
+		}
+		return n
+	}
+
+	present, err := client.Check(ctx, testFilter1, "a")
+	assert.NoError(err)
+	assert.True(present)
+
+	r, err := client.Multi(ctx, testFilter1, "a", "b")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true}, r)
+	assert.Equal(0, countChecks())
+
+	r, err = client.Multi(ctx, testFilter1, "a", "c", "b")
+	assert.NoError(err)
+	assert.Equal([]bool{true, false, true}, r)
+	assert.Equal(1, countChecks())
+	assert.Contains(server.Commands(), "m test_filter_1 c")
+
+	assert.NoError(client.Close(ctx, testFilter1))
+	assert.NoError(client.Clear(ctx, testFilter1))
+	assert.NoError(client.Create(ctx, testFilter1))
+
+	present, err = client.Check(ctx, testFilter1, "a")
+	assert.NoError(err)
+	assert.False(present)
+
+	stats := client.CacheStats()
+	assert.Equal(int64(5), stats.Hits)
+	assert.Equal(int64(2), stats.Misses)
+}
+
+func TestClientPositiveCacheCoalesced(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(), WithPositiveCache(100, 0), WithCheckCoalescing(time.Millisecond))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+	_, err = client.Set(ctx, testFilter1, "a")
+	assert.NoError(err)
+
+	present, err := client.Check(ctx, testFilter1, "a")
+	assert.NoError(err)
+	assert.True(present)
+	present, err = client.Check(ctx, testFilter1, "b")
+	assert.NoError(err)
+	assert.False(present)
+
+	// Coalesced misses are only looked up once.
+	stats := client.CacheStats()
+	assert.Equal(int64(1), stats.Hits)
+	assert.Equal(int64(1), stats.Misses)
+}
+
+func TestClientPositiveCacheAsync(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(), WithPositiveCache(100, 0))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+	_, err = client.Bulk(ctx, testFilter1, "a", "b")
+	assert.NoError(err)
+
+	// Only the keys missing from the cache are sent, and each is looked up once.
+	r, err := client.MultiAsync(ctx, testFilter1, "a", "c", "b").Wait(ctx)
+	assert.NoError(err)
+	assert.Equal([]bool{true, false, true}, r)
+	assert.Contains(server.Commands(), "m test_filter_1 c")
+
+	stats := client.CacheStats()
+	assert.Equal(int64(2), stats.Hits)
+	assert.Equal(int64(1), stats.Misses)
+}
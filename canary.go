@@ -0,0 +1,333 @@
+package bloomd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultCanaryConfidence = 0.95
+	defaultCanaryInterval   = 10 * time.Minute
+	defaultCanaryProbes     = 10000
+	defaultCanaryTimeout    = time.Minute
+)
+
+// Prefix of the canary keys, which are never set.
+const _CANARY_PREFIX = "__bloomd_canary__:"
+
+// CanaryResult is the false positive rate of a filter observed by checking
+// random keys that were never set.
+type CanaryResult struct {
+	Filter string
+	// Probes is the number of keys checked and Hits the number found.
+	Probes int
+	Hits   int
+	// Rate is the observed rate of false positives, within the Lower and Upper
+	// bounds of its Wilson score interval at the Confidence.
+	Rate       float64
+	Lower      float64
+	Upper      float64
+	Confidence float64
+	// Probability is the probability the filter was created with.
+	Probability float64
+	Time        time.Time
+}
+
+// Exceeds reports whether the filter is certain, at the confidence, to have a
+// false positive rate above its probability.
+func (r CanaryResult) Exceeds() bool {
+	return r.Lower > r.Probability
+}
+
+// MeasureFalsePositives checks random keys that were never set in the filter
+// and returns the observed rate of false positives, with its interval at the
+// confidence, e.g. 0.95. Only checks are sent, so the filter is left as it is,
+// and they bypass `WithPositiveCache` and `WithFallbackPolicy`. Measuring a
+// rate around p takes well over 1/p probes.
+//
+// The checks still raise the `Checks` counter of the filter and map it in
+// memory. A Reaper or MemoryBudget sharing the client leaves them out of the
+// activity of the filter, while those of other clients look like real use.
+func (t *Client) MeasureFalsePositives(ctx context.Context, name string, probes int, confidence float64) (CanaryResult, error) {
+	if probes < 1 || confidence <= 0 || confidence >= 1 {
+		return CanaryResult{}, errors.New("bloomd: invalid canary probes/confidence")
+	}
+	name = t.resolve(name)
+
+	info, err := t.info(ctx, name)
+	if err != nil {
+		return CanaryResult{}, err
+	}
+
+	keys, err := canaryKeys(probes)
+	if err != nil {
+		return CanaryResult{}, err
+	}
+	results, err := t.sendBatch(ctx, _MULTI, name, keys)
+	t.canaries.add(name, probes)
+	if err != nil {
+		return CanaryResult{}, err
+	}
+
+	hits := 0
+	for _, hit := range results {
+		if hit {
+			hits++
+		}
+	}
+
+	lower, upper := wilsonInterval(hits, probes, confidence)
+	return CanaryResult{
+		Filter:      name,
+		Probes:      probes,
+		Hits:        hits,
+		Rate:        float64(hits) / float64(probes),
+		Lower:       lower,
+		Upper:       upper,
+		Confidence:  confidence,
+		Probability: float64(info.Probability),
+		Time:        time.Now(),
+	}, nil
+}
+
+// canaryChecks counts the canary checks sent per filter, so that the activity
+// of a filter can be told from its probes.
+type canaryChecks struct {
+	mu     sync.Mutex
+	checks map[string]int
+}
+
+func (c *canaryChecks) add(name string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checks == nil {
+		c.checks = make(map[string]int)
+	}
+	c.checks[name] += n
+}
+
+// get returns the number of canary checks sent to the filter so far.
+func (c *canaryChecks) get(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checks[name]
+}
+
+// canaryKeys returns n random keys.
+func canaryKeys(n int) ([]string, error) {
+	buf := make([]byte, 16*n)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, errors.Wrap(err, "bloomd: failed to generate canary keys")
+	}
+
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = _CANARY_PREFIX + hex.EncodeToString(buf[16*i:16*(i+1)])
+	}
+	return keys, nil
+}
+
+// wilsonInterval returns the Wilson score interval of the proportion of hits
+// at the confidence, which unlike the normal approximation holds for the few
+// hits of low rates.
+func wilsonInterval(hits int, n int, confidence float64) (float64, float64) {
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	p := float64(hits) / float64(n)
+	z2n := z * z / float64(n)
+
+	center := (p + z2n/2) / (1 + z2n)
+	margin := z * math.Sqrt(p*(1-p)/float64(n)+z2n/(4*float64(n))) / (1 + z2n)
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// CanaryOption is configuration setting for the CanaryProber.
+type CanaryOption func(*canaryOptions)
+
+type canaryOptions struct {
+	confidence float64
+	handler    func(CanaryResult)
+	interval   time.Duration
+	probes     int
+}
+
+// WithCanaryConfidence sets the confidence of the intervals. Defaults to
+// 0.95.
+func WithCanaryConfidence(confidence float64) CanaryOption {
+	return func(o *canaryOptions) {
+		o.confidence = confidence
+	}
+}
+
+// WithCanaryHandler sets a handler called with every measurement, e.g. to
+// export them as metrics.
+func WithCanaryHandler(handler func(CanaryResult)) CanaryOption {
+	return func(o *canaryOptions) {
+		o.handler = handler
+	}
+}
+
+// WithCanaryInterval sets how often the filters are measured. Zero or less
+// disables the background measurements, leaving them to `Probe`. Defaults to
+// 10 minutes.
+func WithCanaryInterval(interval time.Duration) CanaryOption {
+	return func(o *canaryOptions) {
+		o.interval = interval
+	}
+}
+
+// WithCanaryProbes sets the number of keys checked per filter and
+// measurement. Defaults to 10000.
+func WithCanaryProbes(probes int) CanaryOption {
+	return func(o *canaryOptions) {
+		o.probes = probes
+	}
+}
+
+// CanaryProber periodically measures the false positive rate of the filters
+// with a prefix, see `Client.MeasureFalsePositives`. It is safe for
+// concurrent use.
+type CanaryProber struct {
+	client *Client
+	prefix string
+	opts   canaryOptions
+
+	mu      sync.Mutex
+	results map[string]CanaryResult
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewCanaryProber returns a CanaryProber measuring the filters starting with
+// the prefix, every filter if empty, in the background.
+func NewCanaryProber(client *Client, prefix string, opts ...CanaryOption) (*CanaryProber, error) {
+	o := canaryOptions{
+		confidence: defaultCanaryConfidence,
+		interval:   defaultCanaryInterval,
+		probes:     defaultCanaryProbes,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.probes < 1 || o.confidence <= 0 || o.confidence >= 1 {
+		return nil, errors.New("bloomd: invalid canary probes/confidence")
+	}
+
+	p := &CanaryProber{
+		client:  client,
+		prefix:  prefix,
+		opts:    o,
+		results: make(map[string]CanaryResult),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go p.loop()
+
+	return p, nil
+}
+
+// Probe measures every filter once and returns the results. Filters that fail
+// to be measured are skipped and the first error returned. It runs in the
+// background unless disabled with `WithCanaryInterval`.
+func (p *CanaryProber) Probe(ctx context.Context) ([]CanaryResult, error) {
+	filters, err := p.client.ListByPrefix(ctx, p.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []CanaryResult
+	var firstErr error
+	seen := make(map[string]bool, len(filters))
+	for _, filter := range filters {
+		if strings.HasPrefix(filter.Name, _INTERNAL_PREFIX) {
+			continue
+		}
+
+		result, err := p.client.MeasureFalsePositives(ctx, filter.Name, p.opts.probes, p.opts.confidence)
+		if err == FilterDoesNotExist {
+			continue
+		} else if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		seen[filter.Name] = true
+		results = append(results, result)
+
+		if p.opts.handler != nil {
+			p.opts.handler(result)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, result := range results {
+		p.results[result.Filter] = result
+	}
+	if firstErr == nil {
+		for name := range p.results {
+			if !seen[name] {
+				delete(p.results, name)
+			}
+		}
+	}
+	return results, firstErr
+}
+
+// Results returns the latest measurement of every filter, by filter name.
+func (p *CanaryProber) Results() []CanaryResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := make([]CanaryResult, 0, len(p.results))
+	for _, result := range p.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, k int) bool {
+		return results[i].Filter < results[k].Filter
+	})
+	return results
+}
+
+// Close stops the background measurements.
+func (p *CanaryProber) Close() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+	<-p.stopped
+}
+
+func (p *CanaryProber) loop() {
+	defer close(p.stopped)
+
+	if p.opts.interval <= 0 {
+		<-p.stop
+		return
+	}
+
+	ticker := time.NewTicker(p.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultCanaryTimeout)
+			p.Probe(ctx)
+			cancel()
+		case <-p.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package bloomd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasureFalsePositives(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(), WithMaxBatchKeys(1000))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.CreateWithParams(ctx, "filter", 100000, 0.001, false))
+	_, err = client.Bulk(ctx, "filter", "a", "b", "c")
+	assert.NoError(err)
+
+	// The fake server has no false positives.
+	result, err := client.MeasureFalsePositives(ctx, "filter", 10000, 0.95)
+	assert.NoError(err)
+	assert.Equal("filter", result.Filter)
+	assert.Equal(10000, result.Probes)
+	assert.Equal(0, result.Hits)
+	assert.Equal(0.0, result.Rate)
+	assert.Equal(0.0, result.Lower)
+	assert.InDelta(0.000384, result.Upper, 1e-6)
+	assert.InDelta(0.001, result.Probability, 1e-9)
+	assert.False(result.Exceeds())
+
+	// The canaries are only checked.
+	info, err := client.Info(ctx, "filter")
+	assert.NoError(err)
+	assert.Equal(3, info.Size)
+	for _, cmd := range server.Commands() {
+		assert.NotRegexp(`^(s|b) filter __bloomd_canary__`, cmd)
+	}
+
+	_, err = client.MeasureFalsePositives(ctx, "missing", 100, 0.95)
+	assert.Equal(FilterDoesNotExist, err)
+	_, err = client.MeasureFalsePositives(ctx, "filter", 0, 0.95)
+	assert.Error(err)
+	_, err = client.MeasureFalsePositives(ctx, "filter", 100, 1)
+	assert.Error(err)
+
+	lower, upper := wilsonInterval(10, 1000, 0.95)
+	assert.InDelta(0.00544, lower, 1e-5)
+	assert.InDelta(0.01831, upper, 1e-5)
+	assert.True(CanaryResult{Lower: 0.0054, Probability: 0.001}.Exceeds())
+}
+
+func TestCanaryProber(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	for _, name := range []string{"users", "events", "__bloomd_marker"} {
+		assert.NoError(client.Create(ctx, name))
+	}
+
+	var handled []CanaryResult
+	p, err := NewCanaryProber(client, "",
+		WithCanaryInterval(0),
+		WithCanaryProbes(100),
+		WithCanaryConfidence(0.99),
+		WithCanaryHandler(func(r CanaryResult) { handled = append(handled, r) }))
+	assert.NoError(err)
+	defer p.Close()
+
+	results, err := p.Probe(ctx)
+	assert.NoError(err)
+	assert.Len(results, 2)
+	assert.Equal(results, handled)
+	for _, r := range results {
+		assert.Equal(100, r.Probes)
+		assert.Equal(0.99, r.Confidence)
+	}
+
+	assert.NoError(client.Drop(ctx, "events"))
+	_, err = p.Probe(ctx)
+	assert.NoError(err)
+	results = p.Results()
+	assert.Len(results, 1)
+	assert.Equal("users", results[0].Filter)
+
+	_, err = NewCanaryProber(client, "", WithCanaryProbes(0))
+	assert.Error(err)
+}
+
+func TestCanaryActivity(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+	assert.NoError(client.Create(ctx, "filter"))
+
+	r, err := NewReaper(client, "", WithReapIdlePolls(2), WithReapInterval(0))
+	assert.NoError(err)
+	defer r.Close()
+	m, err := NewMemoryBudget(client, 1<<40, WithBudgetInterval(0))
+	assert.NoError(err)
+	defer m.Close()
+
+	probe := func() {
+		_, err := client.MeasureFalsePositives(ctx, "filter", 100, 0.95)
+		assert.NoError(err)
+		info, err := client.Info(ctx, "filter")
+		assert.NoError(err)
+		assert.True(info.Checks > 0)
+	}
+
+	// Probes do not keep the filter from being idle.
+	for i := 0; i < 2; i++ {
+		_, err = r.Reap(ctx)
+		assert.NoError(err)
+		assert.NoError(m.Balance(ctx))
+		probe()
+	}
+	events, err := r.Reap(ctx)
+	assert.NoError(err)
+	assert.Equal([]ReapEvent{{Filter: "filter", Action: ReapClose, Reason: "idle"}}, events)
+
+	// A closed filter mapped in again by a probe is closed again.
+	probe()
+	events, err = r.Reap(ctx)
+	assert.NoError(err)
+	assert.Len(events, 1)
+
+	assert.NoError(m.Balance(ctx))
+	stats := m.Stats()
+	assert.Len(stats.Filters, 1)
+	assert.Equal(0.0, stats.Filters[0].Activity)
+	assert.True(stats.Filters[0].Mapped)
+}
@@ -0,0 +1,252 @@
+// Command bloomd-cli manages a bloomD server.
+//
+//	bloomd-cli [-addr localhost:8673] plan -f filters.yaml [-drop-unlisted]
+//	bloomd-cli [-addr localhost:8673] apply -f filters.yaml [-drop-unlisted]
+//	bloomd-cli capacity -elements 1000000 -probability 0.001 [-growth 1.5]
+//	bloomd-cli [-addr localhost:8673] estimate [-target 0.001] [filter ...]
+//	bloomd-cli [-addr localhost:8673] canary [-probes 10000] [-confidence 0.95] [filter ...]
+//
+// `plan` prints the changes bringing the server in line with the spec, and
+// `apply` makes them. Filters missing from the spec are only dropped with
+// `-drop-unlisted`.
+//
+// `capacity` recommends the parameters and predicts the storage of a filter.
+// `estimate` prints the estimated false positive rate of the filters, every
+// filter by default, and fails if any is degraded past its target. `canary`
+// measures their actual rate by checking random keys that were never set, and
+// fails if any is certain to exceed the probability it was created with.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	bloomd "github.com/eduardoramirez/go-bloomd"
+	"github.com/eduardoramirez/go-bloomd/planner"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("bloomd-cli", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	addr := global.String("addr", "localhost:8673", "address of the bloomD server")
+	timeout := global.Duration("timeout", time.Minute, "timeout of the whole command")
+	global.Usage = func() {
+		fmt.Fprintln(stderr, "usage: bloomd-cli [flags] plan|apply|capacity|estimate|canary [command flags]")
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var err error
+	switch cmd, args := global.Arg(0), global.Args()[1:]; cmd {
+	case "plan", "apply":
+		err = provision(ctx, *addr, cmd == "apply", args, stdout, stderr)
+	case "capacity":
+		err = capacity(args, stdout, stderr)
+	case "estimate":
+		err = estimate(ctx, *addr, args, stdout, stderr)
+	case "canary":
+		err = canary(ctx, *addr, args, stdout, stderr)
+	default:
+		global.Usage()
+		return 2
+	}
+
+	if err == flag.ErrHelp {
+		return 2
+	} else if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func provision(ctx context.Context, addr string, apply bool, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("provision", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	file := flags.String("f", "", "YAML or JSON file declaring the filters")
+	dropUnlisted := flags.Bool("drop-unlisted", false, "drop the filters missing from the spec")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("bloomd-cli: -f is required")
+	}
+
+	spec, err := bloomd.LoadProvisionSpec(*file)
+	if err != nil {
+		return err
+	}
+
+	client, err := bloomd.NewClient(addr, bloomd.WithInitialConnections(1))
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+
+	plan, err := client.PlanProvisioning(ctx, spec, *dropUnlisted)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		fmt.Fprintln(stdout, "No changes, the server matches the spec.")
+		return nil
+	}
+	for _, c := range plan.Changes {
+		fmt.Fprintln(stdout, c)
+	}
+
+	if !apply {
+		return nil
+	}
+	if err := client.ApplyProvisioning(ctx, plan); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "Applied.")
+	return nil
+}
+
+func capacity(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("capacity", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	elements := flags.Int("elements", 0, "expected number of elements")
+	probability := flags.Float64("probability", 0.0001, "target false positive rate")
+	growth := flags.Float64("growth", 1, "expected growth of the elements over the filter lifetime")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	plan, err := planner.Recommend(*elements, *probability, *growth)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(w, "capacity\t%d\n", plan.Capacity)
+	fmt.Fprintf(w, "probability\t%g\n", plan.Probability)
+	fmt.Fprintf(w, "bits\t%d\n", plan.Bits)
+	fmt.Fprintf(w, "hashes\t%d\n", plan.Hashes)
+	fmt.Fprintf(w, "storage\t%d bytes\n", plan.StorageBytes)
+	return w.Flush()
+}
+
+func estimate(ctx context.Context, addr string, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("estimate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	target := flags.Float64("target", 0, "false positive rate past which a filter is degraded, its own probability by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := bloomd.NewClient(addr, bloomd.WithInitialConnections(1))
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+
+	names := flags.Args()
+	if len(names) == 0 {
+		filters, err := client.ListAll(ctx)
+		if err != nil {
+			return err
+		}
+		for _, filter := range filters {
+			names = append(names, filter.Name)
+		}
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILTER\tSIZE\tCAPACITY\tLAYERS\tFP RATE\tTARGET\t")
+	var degraded []string
+	for _, name := range names {
+		info, err := client.Info(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		e := planner.EstimateFilter(info, *target)
+		status := ""
+		if e.Degraded {
+			status = "DEGRADED"
+			degraded = append(degraded, name)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.3g\t%.3g\t%s\n", e.Filter, e.Size, e.Capacity, e.Layers, e.FalsePositiveRate, e.Target, status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(degraded) > 0 {
+		return fmt.Errorf("bloomd-cli: %d filters degraded past their target: %v", len(degraded), degraded)
+	}
+	return nil
+}
+
+func canary(ctx context.Context, addr string, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("canary", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	probes := flags.Int("probes", 10000, "number of random keys checked per filter")
+	confidence := flags.Float64("confidence", 0.95, "confidence of the intervals")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := bloomd.NewClient(addr, bloomd.WithInitialConnections(1))
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+
+	names := flags.Args()
+	if len(names) == 0 {
+		filters, err := client.ListAll(ctx)
+		if err != nil {
+			return err
+		}
+		for _, filter := range filters {
+			names = append(names, filter.Name)
+		}
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILTER\tPROBES\tHITS\tFP RATE\tINTERVAL\tPROBABILITY\t")
+	var exceeding []string
+	for _, name := range names {
+		r, err := client.MeasureFalsePositives(ctx, name, *probes, *confidence)
+		if err != nil {
+			return err
+		}
+
+		status := ""
+		if r.Exceeds() {
+			status = "EXCEEDED"
+			exceeding = append(exceeding, name)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.3g\t%.3g-%.3g\t%.3g\t%s\n", r.Filter, r.Probes, r.Hits, r.Rate, r.Lower, r.Upper, r.Probability, status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(exceeding) > 0 {
+		return fmt.Errorf("bloomd-cli: %d filters exceed their probability: %v", len(exceeding), exceeding)
+	}
+	return nil
+}
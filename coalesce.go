@@ -0,0 +1,97 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultCoalesceTimeout = 5 * time.Second
+
+// checkCoalescer merges concurrent checks against the same filter into a
+// single multi command. Checks for a key that is already pending or in flight
+// share its result instead of being sent again.
+type checkCoalescer struct {
+	client *Client
+	window time.Duration
+
+	mu       sync.Mutex
+	pending  map[string][]string
+	inflight map[string]map[string]*BoolFuture
+}
+
+func newCheckCoalescer(client *Client, window time.Duration) *checkCoalescer {
+	return &checkCoalescer{
+		client:   client,
+		window:   window,
+		pending:  make(map[string][]string),
+		inflight: make(map[string]map[string]*BoolFuture),
+	}
+}
+
+// check returns the future for the key, queueing it if nobody else asked for
+// it yet. The first key queued for a filter starts the window after which the
+// whole batch is sent.
+func (c *checkCoalescer) check(name string, key string) *BoolFuture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	futures, ok := c.inflight[name]
+	if !ok {
+		futures = make(map[string]*BoolFuture)
+		c.inflight[name] = futures
+	}
+	if f, ok := futures[key]; ok {
+		return f
+	}
+
+	f := newBoolFuture()
+	futures[key] = f
+
+	keys, ok := c.pending[name]
+	if !ok {
+		time.AfterFunc(c.window, func() { c.flush(name) })
+	}
+	c.pending[name] = append(keys, key)
+
+	return f
+}
+
+// flush sends the pending keys of the filter and fans the results out.
+func (c *checkCoalescer) flush(name string) {
+	c.mu.Lock()
+	keys := c.pending[name]
+	delete(c.pending, name)
+	c.mu.Unlock()
+
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCoalesceTimeout)
+	defer cancel()
+
+	// The cache and the fallback policy are left to `Check`, so they apply
+	// once per check and assumed answers are never cached.
+	results, err := c.client.sendBatchReprovisioned(ctx, _MULTI, name, keys)
+
+	c.mu.Lock()
+	futures := c.inflight[name]
+	resolved := make([]*BoolFuture, len(keys))
+	for i, key := range keys {
+		resolved[i] = futures[key]
+		delete(futures, key)
+	}
+	if len(futures) == 0 {
+		delete(c.inflight, name)
+	}
+	c.mu.Unlock()
+
+	for i, f := range resolved {
+		if err != nil {
+			f.resolve(false, err)
+		} else {
+			f.resolve(results[i], nil)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCoalescing(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(), WithCheckCoalescing(20*time.Millisecond))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+	_, err = client.Bulk(ctx, testFilter1, "key-0", "key-2", "key-4")
+	assert.NoError(err)
+
+	results := make([]bool, 50)
+	errs := make([]error, 50)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every key is requested ten times.
+			results[i], errs[i] = client.Check(ctx, testFilter1, fmt.Sprintf("key-%d", i%5))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range results {
+		assert.NoError(errs[i])
+		assert.Equal(i%5%2 == 0, results[i], i)
+	}
+
+	multis := 0
+	checked := 0
+	for _, cmd := range server.Commands() {
+		if strings.HasPrefix(cmd, "m ") {
+			multis++
+			checked += len(strings.Fields(cmd)) - 2
+		}
+		assert.False(strings.HasPrefix(cmd, "c "), cmd)
+	}
+	assert.True(multis >= 1 && multis <= 2, multis)
+	assert.True(checked <= 10, checked)
+}
+
+func TestCheckCoalescingError(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(), WithCheckCoalescing(time.Millisecond))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	_, err = client.Check(context.Background(), "missing", "key")
+	assert.Equal(FilterDoesNotExist, err)
+}
+
+func TestCheckCoalescingFallback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(),
+		WithMaxAttempts(1),
+		WithCheckCoalescing(time.Millisecond),
+		WithPositiveCache(100, 0),
+		WithFallbackPolicy(FallbackAssumePresent))
+	assert.NoError(err)
+	defer client.Shutdown()
+	assert.NoError(client.Create(ctx, "filter"))
+
+	server.Close()
+	present, err := client.Check(ctx, "filter", "never-set")
+	assert.NoError(err)
+	assert.True(present)
+
+	// The assumed answer was not cached.
+	assert.NoError(server.Restart())
+	assert.True(eventually(func() bool {
+		present, err := client.Check(ctx, "filter", "never-set")
+		return err == nil && !present
+	}))
+}
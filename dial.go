@@ -0,0 +1,102 @@
+package bloomd
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const _UNIX_PREFIX = "unix://"
+
+// DialFunc opens a connection to the address on the named network, the same
+// way `net.Dialer.DialContext` does.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// dialer opens the connections to bloomD according to the client options.
+type dialer struct {
+	network   string
+	address   string
+	dial      DialFunc
+	timeout   time.Duration
+	noDelay   bool
+	tlsConfig *tls.Config
+}
+
+func newDialer(hostname string, o *options) *dialer {
+	network, address := splitAddress(hostname)
+
+	dial := o.dialer
+	if dial == nil {
+		dial = (&net.Dialer{KeepAlive: o.keepAlive}).DialContext
+	}
+
+	var tlsConfig *tls.Config
+	if o.tlsConfig != nil {
+		tlsConfig = o.tlsConfig.Clone()
+		if tlsConfig.ServerName == "" && network == "tcp" {
+			if host, _, err := net.SplitHostPort(address); err == nil {
+				tlsConfig.ServerName = host
+			}
+		}
+	}
+
+	return &dialer{
+		network:   network,
+		address:   address,
+		dial:      dial,
+		timeout:   o.dialTimeout,
+		noDelay:   o.noDelay,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// splitAddress returns the network and address of the hostname. Hostnames
+// starting with `unix://` or `/` are Unix socket paths, anything else is a TCP
+// address.
+func splitAddress(hostname string) (string, string) {
+	if strings.HasPrefix(hostname, _UNIX_PREFIX) {
+		return "unix", strings.TrimPrefix(hostname, _UNIX_PREFIX)
+	} else if strings.HasPrefix(hostname, "/") {
+		return "unix", hostname
+	}
+	return "tcp", hostname
+}
+
+// DialContext opens a new connection, completing the TLS handshake if
+// configured.
+func (d *dialer) DialContext(ctx context.Context) (net.Conn, error) {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+
+	conn, err := d.dial(ctx, d.network, d.address)
+	if err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to dial")
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetNoDelay(d.noDelay)
+	}
+
+	if d.tlsConfig == nil {
+		return conn, nil
+	}
+
+	tlsConn := tls.Client(conn, d.tlsConfig)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "bloomd: tls handshake failed")
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
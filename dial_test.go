@@ -0,0 +1,128 @@
+package bloomd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	network, address := splitAddress("localhost:8673")
+	assert.Equal("tcp", network)
+	assert.Equal("localhost:8673", address)
+
+	network, address = splitAddress("unix:///var/run/bloomd.sock")
+	assert.Equal("unix", network)
+	assert.Equal("/var/run/bloomd.sock", address)
+
+	network, address = splitAddress("/var/run/bloomd.sock")
+	assert.Equal("unix", network)
+	assert.Equal("/var/run/bloomd.sock", address)
+}
+
+func TestDialUnix(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := os.MkdirTemp("", "bloomd")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bloomd.sock")
+	ln, err := net.Listen("unix", path)
+	assert.NoError(err)
+	server := serveFakeBloomd(ln)
+	defer server.Close()
+
+	client, err := NewClient(_UNIX_PREFIX + path)
+	assert.NoError(err)
+	defer client.Shutdown()
+	assert.NoError(client.Ping())
+}
+
+func TestWithDialer(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	var dials int32
+	dialer := func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		assert.Equal("tcp", network)
+		return (&net.Dialer{}).DialContext(ctx, network, server.Addr())
+	}
+
+	client, err := NewClient("bloomd.invalid:8673", WithDialer(dialer), WithInitialConnections(2), WithDialTimeout(time.Second))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.Ping())
+	assert.True(atomic.LoadInt32(&dials) >= 2)
+}
+
+func TestDialTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	cert, pool := testCertificate(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	assert.NoError(err)
+	server := serveFakeBloomd(ln)
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Addr())
+	client, err := NewClient(net.JoinHostPort("localhost", port), WithTLS(&tls.Config{RootCAs: pool}))
+	assert.NoError(err)
+	defer client.Shutdown()
+	assert.NoError(client.Ping())
+
+	_, err = NewClient(net.JoinHostPort("localhost", port), WithTLS(&tls.Config{}))
+	assert.Error(err)
+}
+
+// testCertificate returns a self-signed certificate for localhost and a pool
+// trusting it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
@@ -0,0 +1,130 @@
+package bloomd
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// DryRunEvent describes a mutating command the client did not send in
+// dry-run mode.
+type DryRunEvent struct {
+	// Command is the command as it would have been sent.
+	Command string
+	// Response is the simulated response.
+	Response string
+}
+
+// dryRun replaces the mutating commands with read commands telling what they
+// would have done, so their results can be simulated from the live state.
+type dryRun struct {
+	handler func(DryRunEvent)
+}
+
+// newDryRun returns a dry run reporting the commands to the handler, or to the
+// standard logger if nil.
+func newDryRun(handler func(DryRunEvent)) *dryRun {
+	if handler == nil {
+		handler = func(e DryRunEvent) {
+			log.Printf("bloomd: dry run: %s => %s", e.Command, e.Response)
+		}
+	}
+	return &dryRun{handler: handler}
+}
+
+// translate returns the command sent instead, and whether the command is a
+// mutating one needing a simulated response.
+func (d *dryRun) translate(cmd string) (string, bool) {
+	fields := strings.SplitN(cmd, " ", 3)
+	switch fields[0] {
+	case _SET:
+		// A set adds the key unless a check finds it.
+		return _CHECK + cmd[len(_SET):], true
+	case _BULK:
+		return _MULTI + cmd[len(_BULK):], true
+	case _CREATE, _DROP, _CLEAR, _CLOSE, _FLUSH:
+		if len(fields) < 2 {
+			return "", true
+		}
+		// Whether the filter exists decides the response.
+		return _INFO + " " + fields[1], true
+	default:
+		return cmd, false
+	}
+}
+
+// simulate returns the response the mutating command would have had, given
+// the response to the command sent instead.
+func (d *dryRun) simulate(cmd string, resp string) string {
+	fields := strings.SplitN(cmd, " ", 3)
+	exists := false
+	if len(fields) > 1 {
+		_, err := parseInfo(fields[1], resp)
+		exists = err == nil
+	}
+
+	switch fields[0] {
+	case _SET, _BULK:
+		replies := strings.Split(resp, " ")
+		for i, r := range replies {
+			switch r {
+			case _RESPONSE_YES:
+				replies[i] = _RESPONSE_NO
+			case _RESPONSE_NO:
+				replies[i] = _RESPONSE_YES
+			default:
+				// An error reply, passed through as is.
+				return resp
+			}
+		}
+		return strings.Join(replies, " ")
+	case _CREATE:
+		if exists {
+			return _RESPONSE_EXISTS
+		}
+		return _RESPONSE_DONE
+	default:
+		if len(fields) < 2 || exists {
+			return _RESPONSE_DONE
+		}
+		return resp
+	}
+}
+
+// sendPipeline sends the commands with the mutating ones translated, and
+// simulates their responses.
+func (d *dryRun) sendPipeline(ctx context.Context, cmds []string, send func(context.Context, []string) ([]string, error)) ([]string, error) {
+	translated := make([]string, len(cmds))
+	simulated := make([]bool, len(cmds))
+	sent := make([]string, 0, len(cmds))
+	for i, cmd := range cmds {
+		translated[i], simulated[i] = d.translate(cmd)
+		if translated[i] != "" {
+			sent = append(sent, translated[i])
+		}
+	}
+
+	var resps []string
+	if len(sent) > 0 {
+		var err error
+		if resps, err = send(ctx, sent); err != nil {
+			return nil, err
+		}
+	}
+
+	lines := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		var resp string
+		if translated[i] != "" {
+			resp, resps = resps[0], resps[1:]
+		}
+		if !simulated[i] {
+			lines[i] = resp
+			continue
+		}
+
+		lines[i] = d.simulate(cmd, resp)
+		d.handler(DryRunEvent{Command: cmd, Response: lines[i]})
+	}
+	return lines, nil
+}
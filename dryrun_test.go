@@ -0,0 +1,143 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	admin, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer admin.Shutdown()
+	assert.NoError(admin.Create(ctx, "filter"))
+	_, err = admin.Set(ctx, "filter", "a")
+	assert.NoError(err)
+
+	sent := len(server.Commands())
+
+	var mu sync.Mutex
+	var events []DryRunEvent
+	client, err := NewClient(server.Addr(), WithPositiveCache(100, 0), WithDryRun(func(e DryRunEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	added, err := client.Set(ctx, "filter", "a")
+	assert.NoError(err)
+	assert.False(added)
+	added, err = client.Set(ctx, "filter", "b")
+	assert.NoError(err)
+	assert.True(added)
+	results, err := client.Bulk(ctx, "filter", "a", "c")
+	assert.NoError(err)
+	assert.Equal([]bool{false, true}, results)
+	added, err = client.SetAsync(ctx, "filter", "d").Wait(ctx)
+	assert.NoError(err)
+	assert.True(added)
+
+	_, err = client.Set(ctx, "missing", "a")
+	assert.Equal(FilterDoesNotExist, err)
+
+	// Reads still go to bloomD, which never saw the sets.
+	present, err := client.Check(ctx, "filter", "b")
+	assert.NoError(err)
+	assert.False(present)
+	assert.False(server.Has("filter", "b"))
+
+	assert.NoError(client.Create(ctx, "other"))
+	assert.NoError(client.Drop(ctx, "filter"))
+	assert.NoError(client.Close(ctx, "filter"))
+	assert.NoError(client.Clear(ctx, "filter"))
+	assert.NoError(client.FlushAll(ctx))
+	assert.NoError(client.Drop(ctx, "missing"))
+	_, err = client.Info(ctx, "filter")
+	assert.NoError(err)
+	_, err = client.Info(ctx, "other")
+	assert.Equal(FilterDoesNotExist, err)
+
+	for _, cmd := range server.Commands()[sent:] {
+		assert.NotRegexp(`^(s|b|create|drop|clear|close|flush)\b`, cmd)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]DryRunEvent{
+		{Command: "s filter a", Response: "No"},
+		{Command: "s filter b", Response: "Yes"},
+		{Command: "b filter a c", Response: "No Yes"},
+		{Command: "s filter d", Response: "Yes"},
+		{Command: "s missing a", Response: "Filter does not exist"},
+		{Command: "create other", Response: "Done"},
+		{Command: "drop filter", Response: "Done"},
+		{Command: "close filter", Response: "Done"},
+		{Command: "clear filter", Response: "Done"},
+		{Command: "flush", Response: "Done"},
+		{Command: "drop missing", Response: "Filter does not exist"},
+	}, events)
+}
+
+func TestDryRunOffline(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	client, err := NewClient(freeAddr(t),
+		WithLazyConnect(true),
+		WithMaxAttempts(1),
+		WithJournal(JournalConfig{Dir: dir}),
+		WithLocalFallback(100),
+		WithDryRun(func(DryRunEvent) {}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	// Nothing is journaled or set locally to be replayed later.
+	_, err = client.Set(ctx, "filter", "a")
+	assert.Error(err)
+	assert.NotEqual(ErrJournaled, err)
+	_, err = client.Bulk(ctx, "filter", "b", "c")
+	assert.Error(err)
+	assert.Equal(int64(0), client.JournalStats().Appended)
+	assert.Equal(LocalFallbackStats{}, client.LocalFallbackStats())
+}
+
+func TestDryRunJournal(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal := WithJournal(JournalConfig{Dir: dir, ReplayInterval: 10 * time.Millisecond})
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(), WithMaxAttempts(1), journal)
+	assert.NoError(err)
+	assert.NoError(client.Create(ctx, "filter"))
+	server.Close()
+	_, err = client.Set(ctx, "filter", "a")
+	assert.Equal(ErrJournaled, err)
+	client.Shutdown()
+
+	// A dry-run client does not replay the journal.
+	assert.NoError(server.Restart())
+	client, err = NewClient(server.Addr(), journal, WithDryRun(func(DryRunEvent) {}))
+	assert.NoError(err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int64(0), client.JournalStats().Replayed)
+	assert.True(client.JournalStats().PendingBytes > 0)
+	assert.False(server.Has("filter", "a"))
+	client.Shutdown()
+
+	client, err = NewClient(server.Addr(), journal)
+	assert.NoError(err)
+	defer client.Shutdown()
+	assert.True(eventually(func() bool { return server.Has("filter", "a") }))
+}
@@ -1,8 +1,67 @@
 package bloomd
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	pkgerrors "github.com/pkg/errors"
+)
 
 var (
 	FilterDoesNotExist = errors.New("Filter does not exist")
 	DeleteInProgress   = errors.New("Delete in progress")
+
+	// ErrBatchWriterClosed is returned for sets issued after the BatchWriter
+	// was closed.
+	ErrBatchWriterClosed = errors.New("bloomd: batch writer closed")
+
+	// ErrClientShutdown is returned for asynchronous requests still pending
+	// when the client was shut down.
+	ErrClientShutdown = errors.New("bloomd: client shut down")
+
+	// ErrUDPWriterClosed is returned for writes issued after the UDPWriter was
+	// closed.
+	ErrUDPWriterClosed = errors.New("bloomd: udp writer closed")
+
+	// ErrCircuitOpen is returned without contacting bloomD while the circuit
+	// breaker is open.
+	ErrCircuitOpen = errors.New("bloomd: circuit breaker is open")
+
+	// ErrFilterReset is the reason given when the counters of a filter went
+	// backwards, meaning bloomD restarted and may have lost recent sets.
+	ErrFilterReset = errors.New("bloomd: filter counters went backwards")
+
+	// ErrJournaled is returned for sets that failed to reach bloomD but were
+	// written to the journal, to be replayed once bloomD is back.
+	ErrJournaled = errors.New("bloomd: set journaled for replay")
+
+	// ErrProtectedFilter is returned when dropping or clearing a protected
+	// filter without `OverrideProtection`.
+	ErrProtectedFilter = errors.New("bloomd: filter is protected")
+
+	// ErrReadOnly is returned for the mutating commands of a read-only
+	// client.
+	ErrReadOnly = errors.New("bloomd: client is read-only")
+
+	// ErrJournalFull is returned when the journal holds as many entries
+	// waiting for replay as allowed.
+	ErrJournalFull = errors.New("bloomd: journal full")
 )
+
+// isUnavailable reports whether the error comes from failing to reach bloomD,
+// as opposed to an error reply.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch cause := pkgerrors.Cause(err); cause {
+	case ErrCircuitOpen, io.EOF, io.ErrUnexpectedEOF, context.DeadlineExceeded:
+		return true
+	default:
+		_, ok := cause.(net.Error)
+		return ok
+	}
+}
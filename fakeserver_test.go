@@ -0,0 +1,436 @@
+package bloomd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBloomd is a small in-process stand-in for bloomd that speaks enough of
+// the text protocol for the client tests. Filters are exact sets, so there
+// are never false positives.
+type fakeBloomd struct {
+	ln  net.Listener
+	udp net.PacketConn
+
+	mu        sync.Mutex
+	filters   map[string]*fakeFilter
+	conns     map[net.Conn]struct{}
+	commands  []string
+	datagrams int
+	maxLine   int
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+type fakeFilter struct {
+	capacity    int
+	probability float64
+	inMemory    bool
+	keys        map[string]struct{}
+	proxied     bool
+
+	checks, checkHits, checkMisses int
+	sets, setHits, setMisses       int
+}
+
+// newFakeBloomd starts a fake server on a random local port and stops it when
+// the test finishes.
+func newFakeBloomd(t *testing.T) *fakeBloomd {
+	f, err := startFakeBloomd("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.Close)
+	return f
+}
+
+func startFakeBloomd(addr string) (*fakeBloomd, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return serveFakeBloomd(ln), nil
+}
+
+// serveFakeBloomd starts a fake server accepting connections from the
+// listener.
+func serveFakeBloomd(ln net.Listener) *fakeBloomd {
+	f := &fakeBloomd{
+		ln:      ln,
+		filters: make(map[string]*fakeFilter),
+		conns:   make(map[net.Conn]struct{}),
+	}
+
+	f.wg.Add(1)
+	go f.serve()
+	return f
+}
+
+// Addr returns the TCP address the server is listening on.
+func (f *fakeBloomd) Addr() string {
+	return f.ln.Addr().String()
+}
+
+// Close stops the server and drops every open connection.
+func (f *fakeBloomd) Close() {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	f.ln.Close()
+	if f.udp != nil {
+		f.udp.Close()
+	}
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+}
+
+// Restart stops the server and starts it again on the same address. Like
+// bloomd, filters are reloaded from disk with fresh counters, and in-memory
+// filters are lost.
+func (f *fakeBloomd) Restart() error {
+	f.Close()
+
+	for name, filter := range f.filters {
+		if filter.inMemory {
+			delete(f.filters, name)
+			continue
+		}
+		filter.proxied = false
+		filter.checks, filter.checkHits, filter.checkMisses = 0, 0, 0
+		filter.sets, filter.setHits, filter.setMisses = 0, 0, 0
+	}
+
+	ln, err := net.Listen("tcp", f.ln.Addr().String())
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.ln = ln
+	f.closed = false
+	f.mu.Unlock()
+
+	f.wg.Add(1)
+	go f.serve()
+	return nil
+}
+
+// ListenUDP starts the UDP interface of the server, which runs commands
+// without replying, and returns its address.
+func (f *fakeBloomd) ListenUDP() (string, error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	f.udp = pc
+	f.mu.Unlock()
+
+	f.wg.Add(1)
+	go f.serveUDP(pc)
+	return pc.LocalAddr().String(), nil
+}
+
+// Datagrams returns the number of datagrams received on the UDP interface.
+func (f *fakeBloomd) Datagrams() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.datagrams
+}
+
+// SetMaxLine makes the server reject command lines longer than n bytes, the
+// way bloomd does when its input buffer overflows.
+func (f *fakeBloomd) SetMaxLine(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxLine = n
+}
+
+// Commands returns every command line the server has received.
+func (f *fakeBloomd) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// Has reports whether key was set in the named filter.
+func (f *fakeBloomd) Has(name, key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	filter, ok := f.filters[name]
+	if !ok {
+		return false
+	}
+	_, ok = filter.keys[key]
+	return ok
+}
+
+func (f *fakeBloomd) serve() {
+	defer f.wg.Done()
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			conn.Close()
+			return
+		}
+		f.conns[conn] = struct{}{}
+		f.mu.Unlock()
+
+		f.wg.Add(1)
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeBloomd) serveUDP(pc net.PacketConn) {
+	defer f.wg.Done()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		for _, line := range strings.Split(strings.TrimRight(string(buf[:n]), "\n"), "\n") {
+			f.exec(line)
+		}
+
+		f.mu.Lock()
+		f.datagrams++
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeBloomd) handle(conn net.Conn) {
+	defer f.wg.Done()
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if _, err := conn.Write([]byte(f.exec(line))); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs a single command line and returns the raw reply.
+func (f *fakeBloomd) exec(line string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commands = append(f.commands, line)
+
+	if f.maxLine > 0 && len(line)+1 > f.maxLine {
+		return "Client Error: Command too long\n"
+	}
+
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return "Client Error: Command not supported\n"
+	}
+
+	switch args[0] {
+	case "create":
+		return f.create(args[1:])
+	case "list":
+		prefix := ""
+		if len(args) > 1 {
+			prefix = args[1]
+		}
+		return f.list(prefix)
+	case "flush":
+		if len(args) > 1 {
+			if _, ok := f.filters[args[1]]; !ok {
+				return "Filter does not exist\n"
+			}
+		}
+		return "Done\n"
+	}
+
+	if len(args) < 2 {
+		return "Client Error: Must provide filter name\n"
+	}
+
+	name := args[1]
+	filter, ok := f.filters[name]
+	if !ok {
+		return "Filter does not exist\n"
+	}
+
+	switch args[0] {
+	case "drop":
+		delete(f.filters, name)
+		return "Done\n"
+	case "close":
+		filter.proxied = true
+		return "Done\n"
+	case "clear":
+		if !filter.proxied {
+			return "Filter is not proxied. Close it first.\n"
+		}
+		delete(f.filters, name)
+		return "Done\n"
+	case "info":
+		return filter.info()
+	case "s", "set", "c", "check":
+		if len(args) != 3 {
+			return "Client Error: Must provide filter name and key\n"
+		}
+		return filter.apply(args[0], args[2:]) + "\n"
+	case "b", "bulk", "m", "multi":
+		if len(args) < 3 {
+			return "Client Error: Must provide filter name and at least one key\n"
+		}
+		return filter.apply(args[0], args[2:]) + "\n"
+	}
+
+	return "Client Error: Command not supported\n"
+}
+
+func (f *fakeBloomd) create(args []string) string {
+	if len(args) == 0 {
+		return "Client Error: Must provide filter name\n"
+	}
+	if _, ok := f.filters[args[0]]; ok {
+		return "Exists\n"
+	}
+
+	filter := &fakeFilter{
+		capacity:    100000,
+		probability: 0.0001,
+		keys:        make(map[string]struct{}),
+	}
+	for _, arg := range args[1:] {
+		switch {
+		case strings.HasPrefix(arg, "capacity="):
+			filter.capacity, _ = strconv.Atoi(strings.TrimPrefix(arg, "capacity="))
+		case strings.HasPrefix(arg, "prob="):
+			filter.probability, _ = strconv.ParseFloat(strings.TrimPrefix(arg, "prob="), 64)
+		case arg == "in_memory=1":
+			filter.inMemory = true
+		default:
+			return "Client Error: Bad arguments\n"
+		}
+	}
+
+	f.filters[args[0]] = filter
+	return "Done\n"
+}
+
+func (f *fakeBloomd) list(prefix string) string {
+	names := make([]string, 0, len(f.filters))
+	for name := range f.filters {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	bldr := &strings.Builder{}
+	bldr.WriteString("START\n")
+	for _, name := range names {
+		filter := f.filters[name]
+		fmt.Fprintf(bldr, "%s %f %d %d %d\n", name, filter.probability, filter.storage(), filter.capacity, len(filter.keys))
+	}
+	bldr.WriteString("END\n")
+	return bldr.String()
+}
+
+func (filter *fakeFilter) storage() int {
+	return filter.capacity * 3
+}
+
+func (filter *fakeFilter) info() string {
+	bldr := &strings.Builder{}
+	bldr.WriteString("START\n")
+	fmt.Fprintf(bldr, "capacity %d\n", filter.capacity)
+	fmt.Fprintf(bldr, "checks %d\n", filter.checks)
+	fmt.Fprintf(bldr, "check_hits %d\n", filter.checkHits)
+	fmt.Fprintf(bldr, "check_misses %d\n", filter.checkMisses)
+	fmt.Fprintf(bldr, "page_ins %d\n", 0)
+	fmt.Fprintf(bldr, "page_outs %d\n", 0)
+	fmt.Fprintf(bldr, "probability %f\n", filter.probability)
+	fmt.Fprintf(bldr, "sets %d\n", filter.sets)
+	fmt.Fprintf(bldr, "set_hits %d\n", filter.setHits)
+	fmt.Fprintf(bldr, "set_misses %d\n", filter.setMisses)
+	fmt.Fprintf(bldr, "size %d\n", len(filter.keys))
+	fmt.Fprintf(bldr, "storage %d\n", filter.storage())
+	bldr.WriteString("END\n")
+	return bldr.String()
+}
+
+// apply runs a set or check style command and returns the space separated
+// Yes/No replies.
+func (filter *fakeFilter) apply(cmd string, keys []string) string {
+	filter.proxied = false
+
+	replies := make([]string, len(keys))
+	for i, key := range keys {
+		_, present := filter.keys[key]
+		switch cmd {
+		case "s", "set", "b", "bulk":
+			filter.sets++
+			if present {
+				filter.setMisses++
+				replies[i] = "No"
+			} else {
+				filter.setHits++
+				filter.keys[key] = struct{}{}
+				replies[i] = "Yes"
+			}
+		default:
+			filter.checks++
+			if present {
+				filter.checkHits++
+				replies[i] = "Yes"
+			} else {
+				filter.checkMisses++
+				replies[i] = "No"
+			}
+		}
+	}
+	return strings.Join(replies, " ")
+}
+
+// eventually polls the condition until it holds or a second has passed.
+func eventually(condition func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return condition()
+}
@@ -0,0 +1,142 @@
+package bloomd
+
+import "sync/atomic"
+
+// FallbackPolicy decides what `Check` and `Multi` return when bloomD cannot
+// be reached.
+type FallbackPolicy int
+
+const (
+	// FallbackError returns the error, the default.
+	FallbackError FallbackPolicy = iota
+	// FallbackAssumePresent answers that every key is present (fail-closed),
+	// e.g. to drop work that may be a duplicate.
+	FallbackAssumePresent
+	// FallbackAssumeAbsent answers that every key is absent (fail-open), e.g.
+	// to process work that may be a duplicate.
+	FallbackAssumeAbsent
+)
+
+func (p FallbackPolicy) String() string {
+	switch p {
+	case FallbackError:
+		return "error"
+	case FallbackAssumePresent:
+		return "assume-present"
+	case FallbackAssumeAbsent:
+		return "assume-absent"
+	default:
+		return "unknown"
+	}
+}
+
+// FallbackEvent describes a check answered according to the fallback policy
+// because bloomD could not be reached.
+type FallbackEvent struct {
+	Filter string
+	Keys   int
+	Policy FallbackPolicy
+	Err    error
+}
+
+// FallbackStats counts the fallback decisions, per policy applied.
+type FallbackStats struct {
+	Errors         int64
+	AssumedPresent int64
+	AssumedAbsent  int64
+}
+
+// fallback applies the fallback policies to failed checks.
+type fallback struct {
+	// Accessed atomically, keep at the top for alignment.
+	errors         int64
+	assumedPresent int64
+	assumedAbsent  int64
+
+	policy  FallbackPolicy
+	filters map[string]FallbackPolicy
+	handler func(FallbackEvent)
+}
+
+func newFallback(policy FallbackPolicy, filters map[string]FallbackPolicy, handler func(FallbackEvent)) *fallback {
+	return &fallback{
+		policy:  policy,
+		filters: filters,
+		handler: handler,
+	}
+}
+
+// resolve returns the answer for every key of a failed check of the filter,
+// and whether the policy replaces the error with that answer.
+func (f *fallback) resolve(name string, keys int, err error) (bool, bool) {
+	if !isUnavailable(err) {
+		return false, false
+	}
+
+	policy, ok := f.filters[name]
+	if !ok {
+		policy = f.policy
+	}
+
+	switch policy {
+	case FallbackAssumePresent:
+		atomic.AddInt64(&f.assumedPresent, 1)
+	case FallbackAssumeAbsent:
+		atomic.AddInt64(&f.assumedAbsent, 1)
+	default:
+		atomic.AddInt64(&f.errors, 1)
+	}
+
+	if f.handler != nil {
+		f.handler(FallbackEvent{Filter: name, Keys: keys, Policy: policy, Err: err})
+	}
+
+	switch policy {
+	case FallbackAssumePresent:
+		return true, true
+	case FallbackAssumeAbsent:
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+func (f *fallback) snapshot() FallbackStats {
+	return FallbackStats{
+		Errors:         atomic.LoadInt64(&f.errors),
+		AssumedPresent: atomic.LoadInt64(&f.assumedPresent),
+		AssumedAbsent:  atomic.LoadInt64(&f.assumedAbsent),
+	}
+}
+
+// checkFallback applies the fallback policy to a failed check, unless the
+// local fallback answers it. Assumed answers are never cached.
+func (t *Client) checkFallback(name string, key string, err error) (bool, error) {
+	results, err := t.multiFallback(name, []string{key}, err)
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+// multiFallback applies the fallback policy to a failed multi check, unless
+// the local fallback answers it.
+func (t *Client) multiFallback(name string, keys []string, err error) ([]bool, error) {
+	if t.local != nil && isUnavailable(err) {
+		return t.local.check(name, keys...), nil
+	}
+	if t.fallback == nil {
+		return nil, err
+	}
+
+	assumed, ok := t.fallback.resolve(name, len(keys), err)
+	if !ok {
+		return nil, err
+	}
+
+	results := make([]bool, len(keys))
+	for i := range results {
+		results[i] = assumed
+	}
+	return results, nil
+}
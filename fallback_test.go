@@ -0,0 +1,90 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackPolicies(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var events []FallbackEvent
+	client, err := NewClient(freeAddr(t),
+		WithLazyConnect(true),
+		WithMaxAttempts(1),
+		WithFallbackPolicy(FallbackAssumeAbsent),
+		WithFilterFallbackPolicy("dedup", FallbackAssumePresent),
+		WithFilterFallbackPolicy("strict", FallbackError),
+		WithFallbackHandler(func(event FallbackEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	present, err := client.Check(ctx, "other", "key")
+	assert.NoError(err)
+	assert.False(present)
+
+	present, err = client.Check(ctx, "dedup", "key")
+	assert.NoError(err)
+	assert.True(present)
+
+	results, err := client.Multi(ctx, "dedup", "a", "b")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true}, results)
+
+	results, err = client.MultiAsync(ctx, "other", "a", "b").Wait(ctx)
+	assert.NoError(err)
+	assert.Equal([]bool{false, false}, results)
+
+	_, err = client.Check(ctx, "strict", "key")
+	assert.Error(err)
+
+	// Sets are not affected.
+	_, err = client.Set(ctx, "dedup", "key")
+	assert.Error(err)
+
+	assert.Equal(FallbackStats{Errors: 1, AssumedPresent: 2, AssumedAbsent: 2}, client.FallbackStats())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(events, 5)
+	assert.Equal("dedup", events[2].Filter)
+	assert.Equal(2, events[2].Keys)
+	assert.Equal(FallbackAssumePresent, events[2].Policy)
+	assert.True(isUnavailable(events[2].Err))
+	assert.Equal(FallbackError, events[4].Policy)
+}
+
+func TestFallbackIgnoresErrorReplies(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	defer server.Close()
+
+	client, err := NewClient(server.Addr(), WithFallbackPolicy(FallbackAssumePresent))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	_, err = client.Check(ctx, "missing", "key")
+	assert.Error(err)
+	_, err = client.Multi(ctx, "missing", "key")
+	assert.Equal(FilterDoesNotExist, err)
+
+	assert.Equal(FallbackStats{}, client.FallbackStats())
+}
+
+func TestFallbackPolicyString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("error", FallbackError.String())
+	assert.Equal("assume-present", FallbackAssumePresent.String())
+	assert.Equal("assume-absent", FallbackAssumeAbsent.String())
+}
@@ -0,0 +1,72 @@
+package bloomd
+
+import "context"
+
+// BoolFuture is the pending result of an operation on a single key.
+type BoolFuture struct {
+	done   chan struct{}
+	result bool
+	err    error
+}
+
+func newBoolFuture() *BoolFuture {
+	return &BoolFuture{done: make(chan struct{})}
+}
+
+// resolve stores the result and wakes up every waiter. It must be called
+// exactly once.
+func (f *BoolFuture) resolve(result bool, err error) {
+	f.result = result
+	f.err = err
+	close(f.done)
+}
+
+// Done returns a channel that is closed once the result is available.
+func (f *BoolFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the result is available or the context is done.
+func (f *BoolFuture) Wait(ctx context.Context) (bool, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// BoolsFuture is the pending result of an operation on several keys.
+type BoolsFuture struct {
+	done    chan struct{}
+	results []bool
+	err     error
+}
+
+func newBoolsFuture() *BoolsFuture {
+	return &BoolsFuture{done: make(chan struct{})}
+}
+
+// resolve stores the results and wakes up every waiter. It must be called
+// exactly once.
+func (f *BoolsFuture) resolve(results []bool, err error) {
+	f.results = results
+	f.err = err
+	close(f.done)
+}
+
+// Done returns a channel that is closed once the results are available.
+func (f *BoolsFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the results are available or the context is done. The
+// results are in the same order as the keys of the request.
+func (f *BoolsFuture) Wait(ctx context.Context) ([]bool, error) {
+	select {
+	case <-f.done:
+		return f.results, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
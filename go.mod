@@ -7,5 +7,5 @@ require (
 	github.com/pkg/errors v0.8.0
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.2.1
-	gopkg.in/fatih/pool.v2 v2.0.0
+	gopkg.in/yaml.v2 v2.4.0
 )
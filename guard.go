@@ -0,0 +1,98 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"runtime"
+	"time"
+)
+
+// AuditEvent records an admin command, i.e. create, drop, clear, close or
+// flush, whether it was sent or rejected.
+type AuditEvent struct {
+	// Command is the bloomD command, e.g. "drop".
+	Command string
+	// Filter is the name the command was called with, empty for `FlushAll`.
+	Filter string
+	// Context is the context of the call, to attach request or user details.
+	Context context.Context
+	// Caller is the file and line the client method was called from.
+	Caller string
+	// Overridden reports whether the protection of the filter was overridden.
+	Overridden bool
+	Time       time.Time
+	Duration   time.Duration
+	// Err is the failure of the command, e.g. ErrProtectedFilter.
+	Err error
+}
+
+type protectionOverride struct{}
+
+// OverrideProtection returns a context letting `Drop` and `Clear` through for
+// protected filters, see `WithProtectedFilters`.
+func OverrideProtection(ctx context.Context) context.Context {
+	return context.WithValue(ctx, protectionOverride{}, true)
+}
+
+func overridden(ctx context.Context) bool {
+	ok, _ := ctx.Value(protectionOverride{}).(bool)
+	return ok
+}
+
+// checkWritable rejects the sets of a read-only client.
+func (t *Client) checkWritable() error {
+	if t.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// admin runs an admin command on the filter, enforcing the read-only mode and
+// the protected filters, and audits it. The name is the one the method was
+// called with, while the command runs against the target, the filter it
+// resolves to.
+func (t *Client) admin(ctx context.Context, cmd string, name string, target string, run func() error) error {
+	start := time.Now()
+	event := AuditEvent{
+		Command: cmd,
+		Filter:  name,
+		Context: ctx,
+		Time:    start,
+	}
+	if t.auditHandler != nil {
+		// Skip admin and the client method.
+		if _, file, line, ok := runtime.Caller(2); ok {
+			event.Caller = fmt.Sprintf("%s:%d", file, line)
+		}
+	}
+
+	switch {
+	case t.readOnly:
+		event.Err = ErrReadOnly
+	case (cmd == _DROP || cmd == _CLEAR) && (t.protected(name) || t.protected(target)):
+		if event.Overridden = overridden(ctx); !event.Overridden {
+			event.Err = ErrProtectedFilter
+		}
+	}
+
+	if event.Err == nil {
+		event.Err = run()
+	}
+
+	if t.auditHandler != nil {
+		event.Duration = time.Since(start)
+		t.auditHandler(event)
+	}
+	return event.Err
+}
+
+// protected reports whether the filter matches a protected name or pattern.
+func (t *Client) protected(name string) bool {
+	for _, pattern := range t.protectedFilters {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
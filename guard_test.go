@@ -0,0 +1,129 @@
+package bloomd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectedFilters(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+
+	var mu sync.Mutex
+	var audited []AuditEvent
+	client, err := NewClient(server.Addr(),
+		WithProtectedFilters("dedup", "prod-*"),
+		WithAuditHandler(func(e AuditEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			audited = append(audited, e)
+		}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.Create(ctx, "dedup"))
+	assert.NoError(client.Create(ctx, "prod-users"))
+	assert.NoError(client.Create(ctx, "scratch"))
+
+	assert.Equal(ErrProtectedFilter, client.Drop(ctx, "dedup"))
+	assert.NoError(client.Close(ctx, "prod-users"))
+	assert.Equal(ErrProtectedFilter, client.Clear(ctx, "prod-users"))
+	assert.NoError(client.Drop(ctx, "scratch"))
+	assert.NotContains(server.Commands(), "drop dedup")
+	_, err = client.Info(ctx, "dedup")
+	assert.NoError(err)
+
+	type key string
+	override := OverrideProtection(context.WithValue(ctx, key("user"), "alice"))
+	assert.NoError(client.Drop(override, "dedup"))
+	assert.Contains(server.Commands(), "drop dedup")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(audited, 8)
+	assert.Equal("create", audited[0].Command)
+	assert.Equal(ErrProtectedFilter, audited[3].Err)
+	assert.Equal("prod-users", audited[4].Filter)
+	assert.Equal(ErrProtectedFilter, audited[5].Err)
+
+	last := audited[7]
+	assert.Equal("drop", last.Command)
+	assert.Equal("dedup", last.Filter)
+	assert.True(last.Overridden)
+	assert.NoError(last.Err)
+	assert.Equal("alice", last.Context.Value(key("user")))
+	assert.True(strings.Contains(last.Caller, "guard_test.go:"), last.Caller)
+
+	_, err = NewClient(server.Addr(), WithProtectedFilters("["))
+	assert.Error(err)
+}
+
+func TestReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	admin, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer admin.Shutdown()
+	assert.NoError(admin.Create(ctx, "filter"))
+	_, err = admin.Set(ctx, "filter", "a")
+	assert.NoError(err)
+
+	client, err := NewClient(server.Addr(), WithReadOnly(true))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	_, err = client.Set(ctx, "filter", "b")
+	assert.Equal(ErrReadOnly, err)
+	_, err = client.Bulk(ctx, "filter", "b")
+	assert.Equal(ErrReadOnly, err)
+	_, err = client.SetAsync(ctx, "filter", "b").Wait(ctx)
+	assert.Equal(ErrReadOnly, err)
+	_, err = client.BulkAsync(ctx, "filter", "b").Wait(ctx)
+	assert.Equal(ErrReadOnly, err)
+	assert.Equal(ErrReadOnly, client.Create(ctx, "other"))
+	assert.Equal(ErrReadOnly, client.Drop(ctx, "filter"))
+	assert.Equal(ErrReadOnly, client.Clear(ctx, "filter"))
+	assert.False(server.Has("filter", "b"))
+
+	present, err := client.Check(ctx, "filter", "a")
+	assert.NoError(err)
+	assert.True(present)
+	assert.Equal(ErrReadOnly, client.FlushFilter(ctx, "filter"))
+	assert.Equal(ErrReadOnly, client.FlushAll(ctx))
+	assert.Equal(ErrReadOnly, client.Close(ctx, "filter"))
+	assert.NotContains(server.Commands(), "close filter")
+}
+
+func TestReadOnlyJournal(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	journal := WithJournal(JournalConfig{Dir: dir, ReplayInterval: 10 * time.Millisecond})
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(), WithMaxAttempts(1), journal)
+	assert.NoError(err)
+	assert.NoError(client.Create(ctx, "filter"))
+	server.Close()
+	_, err = client.Set(ctx, "filter", "a")
+	assert.Equal(ErrJournaled, err)
+	client.Shutdown()
+
+	// A read-only client does not replay the journal.
+	assert.NoError(server.Restart())
+	client, err = NewClient(server.Addr(), journal, WithReadOnly(true))
+	assert.NoError(err)
+	defer client.Shutdown()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int64(0), client.JournalStats().Replayed)
+	assert.NotContains(server.Commands(), "b filter a")
+}
@@ -0,0 +1,215 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HealthState describes how well the client can reach bloomD.
+type HealthState int
+
+const (
+	// Healthy means the last requests and dials succeeded.
+	Healthy HealthState = iota
+	// Degraded means a connection failed while in use, but new connections
+	// can still be opened.
+	Degraded
+	// Down means no connection could be opened. The client reconnects in the
+	// background until one can.
+	Down
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Degraded:
+		return "degraded"
+	case Down:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// healthMonitor tracks the health state from the outcome of dials and
+// requests, and runs the reconnector while the server is down.
+type healthMonitor struct {
+	listener   func(from, to HealthState)
+	reconnect  func(ctx context.Context) error
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu           sync.Mutex
+	state        HealthState
+	reconnecting bool
+	closed       bool
+
+	// Held while notifying so the listener sees transitions in order.
+	notifyMu sync.Mutex
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newHealthMonitor(listener func(from, to HealthState), minBackoff, maxBackoff time.Duration) *healthMonitor {
+	if minBackoff <= 0 {
+		minBackoff = defaultReconnectMinBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	return &healthMonitor{
+		listener:   listener,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		stop:       make(chan struct{}),
+	}
+}
+
+func (h *healthMonitor) current() HealthState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// dialed records the outcome of opening a connection.
+func (h *healthMonitor) dialed(err error) {
+	if err != nil {
+		h.transition(Down)
+	} else {
+		h.transition(Healthy)
+	}
+}
+
+// requested records the outcome of a request over an open connection.
+func (h *healthMonitor) requested(err error) {
+	if err == nil {
+		h.transition(Healthy)
+		return
+	}
+
+	h.mu.Lock()
+	healthy := h.state == Healthy
+	h.mu.Unlock()
+
+	if healthy {
+		h.transition(Degraded)
+	}
+}
+
+func (h *healthMonitor) transition(to HealthState) {
+	h.mu.Lock()
+	from := h.state
+	if from == to || h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.state = to
+
+	if to == Down && !h.reconnecting && h.reconnect != nil {
+		h.reconnecting = true
+		h.wg.Add(1)
+		go h.reconnectLoop()
+	}
+
+	h.notifyMu.Lock()
+	h.mu.Unlock()
+	defer h.notifyMu.Unlock()
+
+	if h.listener != nil {
+		h.listener(from, to)
+	}
+}
+
+// connect runs the reconnector once in the background, so that the state of a
+// client that opened no connection yet reflects whether the server is up.
+func (h *healthMonitor) connect() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-h.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		h.reconnect(ctx)
+	}()
+}
+
+// reconnectLoop retries to connect with an exponential backoff until the
+// state is back up or the client is shut down.
+func (h *healthMonitor) reconnectLoop() {
+	defer h.wg.Done()
+
+	backoff := h.minBackoff
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(backoff):
+		}
+
+		if h.recovered() {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-h.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err := h.reconnect(ctx)
+		cancel()
+
+		if err == nil {
+			if h.recovered() {
+				return
+			}
+			backoff = h.minBackoff
+			continue
+		}
+
+		backoff *= 2
+		if backoff > h.maxBackoff {
+			backoff = h.maxBackoff
+		}
+	}
+}
+
+// recovered reports whether the reconnector can stop, marking it stopped in
+// the same critical section so a new outage starts a new one.
+func (h *healthMonitor) recovered() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.state != Down || h.closed {
+		h.reconnecting = false
+		return true
+	}
+	return false
+}
+
+// close stops the reconnector. No more transitions are reported.
+func (h *healthMonitor) close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	close(h.stop)
+	h.mu.Unlock()
+
+	h.wg.Wait()
+}
@@ -0,0 +1,72 @@
+package bloomd
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// freeAddr returns a local address nothing is listening on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestLazyConnectAndReconnect(t *testing.T) {
+	assert := assert.New(t)
+	addr := freeAddr(t)
+
+	_, err := NewClient(addr)
+	assert.Error(err)
+
+	var mu sync.Mutex
+	var transitions []HealthState
+	listener := func(from, to HealthState) {
+		mu.Lock()
+		defer mu.Unlock()
+		transitions = append(transitions, to)
+	}
+
+	client, err := NewClient(addr,
+		WithLazyConnect(true),
+		WithInitialConnections(2),
+		WithReconnectBackoff(time.Millisecond, 10*time.Millisecond),
+		WithHealthListener(listener))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	// The client turns Down without waiting for a request.
+	assert.True(eventually(func() bool { return client.Health() == Down }))
+	assert.Error(client.Ping())
+
+	server, err := startFakeBloomd(addr)
+	assert.NoError(err)
+	defer server.Close()
+
+	assert.True(eventually(func() bool { return client.Health() == Healthy }))
+	assert.True(eventually(func() bool { return client.PoolStats().Idle == 2 }))
+	assert.NoError(client.Ping())
+
+	// A connection dropped by the server degrades the client.
+	server.Close()
+	assert.Error(client.Ping())
+	assert.Equal(Degraded, client.Health())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]HealthState{Down, Healthy, Degraded}, transitions)
+}
+
+func TestHealthStateString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("healthy", Healthy.String())
+	assert.Equal("degraded", Degraded.String())
+	assert.Equal("down", Down.String())
+}
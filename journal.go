@@ -0,0 +1,532 @@
+package bloomd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultJournalFsyncInterval  = time.Second
+	defaultJournalMaxBytes       = 1 << 30
+	defaultJournalReplayInterval = time.Second
+	defaultJournalSegmentBytes   = 16 << 20
+
+	defaultJournalReplayTimeout = 5 * time.Second
+	// Number of entries read from the journal at once while replaying.
+	journalReplayEntries = 1000
+
+	_JOURNAL_SUFFIX     = ".journal"
+	_JOURNAL_CHECKPOINT = "checkpoint"
+)
+
+// FsyncPolicy decides when the journal is synced to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs after every append, the default. Nothing acknowledged
+	// with ErrJournaled is lost, even on a machine crash.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncInterval syncs at most every FsyncInterval.
+	FsyncInterval
+	// FsyncNever leaves it to the operating system.
+	FsyncNever
+)
+
+// JournalConfig configures the journal keeping the sets that failed to reach
+// bloomD.
+type JournalConfig struct {
+	// Dir is the directory of the journal segments, created if missing. A
+	// journal directory must not be shared by several clients.
+	Dir string
+	// Fsync decides when appends are synced to disk. Defaults to FsyncAlways.
+	Fsync FsyncPolicy
+	// FsyncInterval is how often the journal is synced with FsyncInterval.
+	// Defaults to 1s.
+	FsyncInterval time.Duration
+	// SegmentBytes is the size past which a new segment is started. Segments
+	// are deleted once replayed. Defaults to 16MiB.
+	SegmentBytes int64
+	// MaxBytes caps the size of the entries waiting to be replayed. Sets that
+	// would exceed it fail with their original error. Defaults to 1GiB.
+	MaxBytes int64
+	// ReplayInterval is how often the replayer checks for entries when no
+	// request succeeded in the meantime. Defaults to 1s.
+	ReplayInterval time.Duration
+}
+
+// JournalStats is a snapshot of the journal counters. Entries are counted in
+// keys.
+type JournalStats struct {
+	Appended    int64
+	Rejected    int64
+	WriteErrors int64
+	Replayed    int64
+	// Dropped is the number of keys replayed but refused by bloomD, e.g.
+	// because the filter no longer exists.
+	Dropped      int64
+	Segments     int
+	PendingBytes int64
+}
+
+type journalEntry struct {
+	name  string
+	keys  []string
+	bytes int64
+}
+
+// journal is a segment-rotated append-only log of the sets that failed to
+// reach bloomD. Entries are replayed in order, at least once, by a background
+// replayer. Progress is kept in a checkpoint file so a restarted client
+// resumes where it stopped.
+type journal struct {
+	cfg    JournalConfig
+	client *Client
+
+	mu       sync.Mutex
+	file     *os.File
+	segments []uint64
+	size     int64
+	readSeq  uint64
+	readOff  int64
+	pending  int64
+	dirty    bool
+	stats    JournalStats
+	closed   bool
+
+	kick chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// openJournal opens the journal in the directory, repairing an entry left
+// half written by a crash. The replayer is not started.
+func openJournal(cfg JournalConfig) (*journal, error) {
+	if cfg.FsyncInterval <= 0 {
+		cfg.FsyncInterval = defaultJournalFsyncInterval
+	}
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = defaultJournalSegmentBytes
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultJournalMaxBytes
+	}
+	if cfg.ReplayInterval <= 0 {
+		cfg.ReplayInterval = defaultJournalReplayInterval
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to create journal directory")
+	}
+
+	segments, err := listSegments(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		segments = []uint64{1}
+	}
+
+	j := &journal{
+		cfg:      cfg,
+		segments: segments,
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+
+	active := j.segmentPath(segments[len(segments)-1])
+	if err := repairSegment(active); err != nil {
+		return nil, err
+	}
+	if j.file, err = os.OpenFile(active, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to open journal segment")
+	}
+	if j.size, err = j.file.Seek(0, io.SeekEnd); err != nil {
+		j.file.Close()
+		return nil, errors.Wrap(err, "bloomd: unable to open journal segment")
+	}
+
+	j.readSeq, j.readOff = readCheckpoint(cfg.Dir)
+	if j.readSeq < segments[0] {
+		j.readSeq, j.readOff = segments[0], 0
+	}
+	for _, seq := range segments {
+		if seq < j.readSeq {
+			continue
+		}
+		info, err := os.Stat(j.segmentPath(seq))
+		if err != nil {
+			continue
+		}
+		j.pending += info.Size()
+		if seq == j.readSeq {
+			j.pending -= j.readOff
+		}
+	}
+
+	return j, nil
+}
+
+// start runs the replayer, and the syncer with FsyncInterval.
+func (j *journal) start(client *Client) {
+	j.client = client
+	j.wg.Add(1)
+	go j.run()
+}
+
+// append writes the keys to the journal. It fails with ErrJournalFull once
+// MaxBytes are waiting to be replayed.
+func (j *journal) append(name string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	line := name + " " + strings.Join(keys, " ") + "\n"
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return ErrClientShutdown
+	}
+	if j.pending+int64(len(line)) > j.cfg.MaxBytes {
+		j.stats.Rejected += int64(len(keys))
+		return ErrJournalFull
+	}
+
+	if j.size >= j.cfg.SegmentBytes {
+		if err := j.rotateLocked(); err != nil {
+			j.stats.WriteErrors += int64(len(keys))
+			return err
+		}
+	}
+
+	n, err := io.WriteString(j.file, line)
+	if err == nil && j.cfg.Fsync == FsyncAlways {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		// Leave no partial entry for the next one to be appended to. If it
+		// cannot be cut off, the next append starts a new segment instead,
+		// and the partial entry is skipped as the last line of its segment.
+		if j.file.Truncate(j.size) != nil {
+			j.size = j.cfg.SegmentBytes
+		}
+		j.stats.WriteErrors += int64(len(keys))
+		return errors.Wrap(err, "bloomd: unable to write journal")
+	}
+
+	j.size += int64(n)
+	j.dirty = true
+	j.pending += int64(n)
+	j.stats.Appended += int64(len(keys))
+	return nil
+}
+
+// rotateLocked starts a new segment.
+func (j *journal) rotateLocked() error {
+	if j.cfg.Fsync != FsyncNever {
+		j.file.Sync()
+	}
+	j.file.Close()
+
+	seq := j.segments[len(j.segments)-1] + 1
+	file, err := os.OpenFile(j.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		// The next append tries again.
+		return errors.Wrap(err, "bloomd: unable to open journal segment")
+	}
+
+	j.file = file
+	j.segments = append(j.segments, seq)
+	j.size = 0
+	return nil
+}
+
+// resume wakes the replayer up. Called whenever bloomD is known to be
+// reachable.
+func (j *journal) resume() {
+	select {
+	case j.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (j *journal) run() {
+	defer j.wg.Done()
+
+	replay := time.NewTicker(j.cfg.ReplayInterval)
+	defer replay.Stop()
+
+	var syncC <-chan time.Time
+	if j.cfg.Fsync == FsyncInterval {
+		ticker := time.NewTicker(j.cfg.FsyncInterval)
+		defer ticker.Stop()
+		syncC = ticker.C
+	}
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-syncC:
+			j.sync()
+		case <-replay.C:
+			j.drain()
+		case <-j.kick:
+			j.drain()
+		}
+	}
+}
+
+func (j *journal) sync() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.dirty && !j.closed {
+		j.file.Sync()
+		j.dirty = false
+	}
+}
+
+// drain replays entries until none is left or bloomD cannot be reached.
+func (j *journal) drain() {
+	for {
+		entries, err := j.read()
+		if err != nil || len(entries) == 0 {
+			return
+		}
+
+		// Consecutive entries of a filter are sent as a single bulk.
+		for start := 0; start < len(entries); {
+			end := start + 1
+			keys := entries[start].keys
+			bytes := entries[start].bytes
+			for end < len(entries) && entries[end].name == entries[start].name {
+				keys = append(keys[:len(keys):len(keys)], entries[end].keys...)
+				bytes += entries[end].bytes
+				end++
+			}
+
+			// Entries without keys are only written by hand.
+			if len(keys) == 0 {
+				j.advance(bytes, 0, true)
+				start = end
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), defaultJournalReplayTimeout)
+			go func() {
+				select {
+				case <-j.stop:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			_, err := j.client.sendBatchReprovisioned(ctx, _BULK, entries[start].name, keys)
+			cancel()
+
+			if isUnavailable(err) || errors.Cause(err) == context.Canceled {
+				return
+			}
+			j.advance(bytes, len(keys), err != nil)
+			start = end
+		}
+	}
+}
+
+// read returns the next entries to replay, moving on to the next segment
+// once one is fully replayed.
+func (j *journal) read() ([]journalEntry, error) {
+	for {
+		j.mu.Lock()
+		if j.closed {
+			j.mu.Unlock()
+			return nil, ErrClientShutdown
+		}
+		seq, off := j.readSeq, j.readOff
+		active := seq == j.segments[len(j.segments)-1]
+		limit := int64(-1)
+		if active {
+			limit = j.size
+		}
+		j.mu.Unlock()
+
+		if active && off >= limit {
+			return nil, nil
+		}
+
+		entries, err := readSegment(j.segmentPath(seq), off, limit, journalReplayEntries)
+		if err != nil || len(entries) > 0 || active {
+			return entries, err
+		}
+
+		j.mu.Lock()
+		os.Remove(j.segmentPath(seq))
+		j.segments = j.segments[1:]
+		j.readSeq, j.readOff = j.segments[0], 0
+		j.saveCheckpointLocked()
+		j.mu.Unlock()
+	}
+}
+
+// advance records that the entries up to the next bytes were replayed.
+func (j *journal) advance(bytes int64, keys int, dropped bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.readOff += bytes
+	j.pending -= bytes
+	if dropped {
+		j.stats.Dropped += int64(keys)
+	} else {
+		j.stats.Replayed += int64(keys)
+	}
+	j.saveCheckpointLocked()
+}
+
+func (j *journal) saveCheckpointLocked() {
+	path := filepath.Join(j.cfg.Dir, _JOURNAL_CHECKPOINT)
+	data := fmt.Sprintf("%d %d\n", j.readSeq, j.readOff)
+	if err := ioutil.WriteFile(path+".tmp", []byte(data), 0644); err == nil {
+		os.Rename(path+".tmp", path)
+	}
+}
+
+func (j *journal) snapshot() JournalStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stats := j.stats
+	stats.Segments = len(j.segments)
+	stats.PendingBytes = j.pending
+	return stats
+}
+
+// close stops the replayer and syncs the journal. Entries not replayed yet
+// are replayed by the next client opening the journal.
+func (j *journal) close() {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return
+	}
+	j.closed = true
+	close(j.stop)
+	j.mu.Unlock()
+
+	j.wg.Wait()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cfg.Fsync != FsyncNever {
+		j.file.Sync()
+	}
+	j.file.Close()
+}
+
+func (j *journal) segmentPath(seq uint64) string {
+	return filepath.Join(j.cfg.Dir, fmt.Sprintf("%020d%s", seq, _JOURNAL_SUFFIX))
+}
+
+// listSegments returns the sequence numbers of the segments in the directory,
+// in order.
+func listSegments(dir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to list journal segments")
+	}
+
+	var segments []uint64
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, _JOURNAL_SUFFIX) {
+			continue
+		}
+		if seq, err := strconv.ParseUint(strings.TrimSuffix(name, _JOURNAL_SUFFIX), 10, 64); err == nil {
+			segments = append(segments, seq)
+		}
+	}
+	sort.Slice(segments, func(i, k int) bool { return segments[i] < segments[k] })
+	return segments, nil
+}
+
+// repairSegment truncates an entry left half written at the end of the
+// segment.
+func repairSegment(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "bloomd: unable to read journal segment")
+	}
+
+	end := strings.LastIndexByte(string(data), '\n') + 1
+	if end == len(data) {
+		return nil
+	}
+	return errors.Wrap(os.Truncate(path, int64(end)), "bloomd: unable to repair journal segment")
+}
+
+// readCheckpoint returns the position replay stopped at, or zero if unknown.
+func readCheckpoint(dir string) (uint64, int64) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, _JOURNAL_CHECKPOINT))
+	if err != nil {
+		return 0, 0
+	}
+
+	var seq uint64
+	var off int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &off); err != nil {
+		return 0, 0
+	}
+	return seq, off
+}
+
+// readSegment reads up to max entries from the offset, stopping at limit
+// bytes unless it is negative.
+func readSegment(path string, off, limit int64, max int) ([]journalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to open journal segment")
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(off, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to read journal segment")
+	}
+
+	var r io.Reader = file
+	if limit >= 0 {
+		r = io.LimitReader(file, limit-off)
+	}
+	reader := bufio.NewReader(r)
+
+	var entries []journalEntry
+	for len(entries) < max {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// A partial line is still being written.
+			break
+		}
+
+		fields := strings.Fields(line)
+		entry := journalEntry{bytes: int64(len(line))}
+		if len(fields) > 1 {
+			entry.name, entry.keys = fields[0], fields[1:]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,152 @@
+package bloomd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalSegments(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	j, err := openJournal(JournalConfig{Dir: dir, SegmentBytes: 16, MaxBytes: 40})
+	assert.NoError(err)
+
+	// The first segment is full after the second entry.
+	assert.NoError(j.append("f", []string{"a", "b", "c"}))
+	assert.NoError(j.append("f", []string{"d", "e", "f", "g"}))
+	assert.NoError(j.append("g", []string{"h"}))
+	assert.NoError(j.append("f", []string{"i", "j", "k", "l", "m", "n"}))
+	assert.Equal(ErrJournalFull, j.append("f", []string{"o", "p"}))
+
+	stats := j.snapshot()
+	assert.Equal(int64(14), stats.Appended)
+	assert.Equal(int64(2), stats.Rejected)
+	assert.Equal(2, stats.Segments)
+	assert.Equal(int64(36), stats.PendingBytes)
+	j.close()
+
+	// An entry half written by a crash is dropped on reopen.
+	active := filepath.Join(dir, "00000000000000000002.journal")
+	file, err := os.OpenFile(active, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(err)
+	file.WriteString("f partial")
+	file.Close()
+
+	j, err = openJournal(JournalConfig{Dir: dir})
+	assert.NoError(err)
+	assert.Equal(int64(36), j.snapshot().PendingBytes)
+
+	data, err := ioutil.ReadFile(active)
+	assert.NoError(err)
+	assert.Equal("g h\nf i j k l m n\n", string(data))
+
+	entries, err := j.read()
+	assert.NoError(err)
+	assert.Len(entries, 2)
+	assert.Equal("f", entries[0].name)
+	assert.Equal([]string{"a", "b", "c"}, entries[0].keys)
+	j.advance(entries[0].bytes+entries[1].bytes, 7, false)
+
+	// The replayed segment is deleted.
+	entries, err = j.read()
+	assert.NoError(err)
+	assert.Len(entries, 2)
+	assert.Equal("g", entries[0].name)
+	assert.Equal(1, j.snapshot().Segments)
+	assert.Equal(int64(18), j.snapshot().PendingBytes)
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000001.journal"))
+	assert.True(os.IsNotExist(err))
+
+	// Progress survives a restart.
+	j.close()
+	j, err = openJournal(JournalConfig{Dir: dir})
+	assert.NoError(err)
+	defer j.close()
+	assert.Equal(int64(18), j.snapshot().PendingBytes)
+}
+
+func TestJournalWriteError(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	j, err := openJournal(JournalConfig{Dir: dir})
+	assert.NoError(err)
+	defer j.close()
+	assert.NoError(j.append("a", []string{"k1"}))
+
+	// A segment that cannot be written to, nor cut back, is left behind with
+	// whatever was written of the failed entry.
+	j.file.WriteString("a k2")
+	j.file.Close()
+	assert.Error(j.append("a", []string{"k3"}))
+	assert.Equal(int64(1), j.snapshot().WriteErrors)
+
+	assert.NoError(j.append("b", []string{"k4"}))
+	assert.Equal(2, j.snapshot().Segments)
+
+	entries, err := j.read()
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal([]string{"k1"}, entries[0].keys)
+	j.advance(entries[0].bytes, 1, false)
+
+	entries, err = j.read()
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal("b", entries[0].name)
+	assert.Equal([]string{"k4"}, entries[0].keys)
+}
+
+func TestClientJournal(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(),
+		WithLazyConnect(true),
+		WithMaxAttempts(1),
+		WithJournal(JournalConfig{Dir: dir, ReplayInterval: 10 * time.Millisecond}))
+	assert.NoError(err)
+
+	assert.NoError(client.Create(ctx, "f"))
+	server.Close()
+	client.Ping()
+
+	_, err = client.Set(ctx, "f", "a")
+	assert.Equal(ErrJournaled, err)
+	_, err = client.Bulk(ctx, "f", "b", "c")
+	assert.Equal(ErrJournaled, err)
+	_, err = client.Set(ctx, "missing", "d")
+	assert.Equal(ErrJournaled, err)
+	_, err = client.SetAsync(ctx, "f", "e").Wait(ctx)
+	assert.Equal(ErrJournaled, err)
+	assert.Equal(int64(5), client.JournalStats().Appended)
+
+	// Whatever is left is replayed by the next client.
+	client.Shutdown()
+
+	assert.NoError(server.Restart())
+	client, err = NewClient(server.Addr(),
+		WithJournal(JournalConfig{Dir: dir, ReplayInterval: 10 * time.Millisecond}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.True(eventually(func() bool { return client.JournalStats().PendingBytes == 0 }))
+	for _, key := range []string{"a", "b", "c", "e"} {
+		assert.True(server.Has("f", key))
+	}
+	assert.Contains(server.Commands(), "b f a b c")
+
+	stats := client.JournalStats()
+	assert.Equal(int64(4), stats.Replayed)
+	assert.Equal(int64(1), stats.Dropped)
+	assert.Equal(1, stats.Segments)
+}
@@ -0,0 +1,336 @@
+package bloomd
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// bloomD defaults, used for filters whose parameters were never seen.
+	defaultLocalCapacity    = 100000
+	defaultLocalProbability = 0.0001
+
+	defaultLocalReplayTimeout = 5 * time.Second
+)
+
+// LocalFallbackStats is a snapshot of the local fallback filters.
+type LocalFallbackStats struct {
+	// Filters is the number of local filters currently held.
+	Filters int
+	// Pending is the number of keys set locally waiting to be replayed.
+	Pending int
+	Sets    int64
+	Checks  int64
+	// Replayed is the number of keys set on bloomD once it came back.
+	Replayed int64
+	// Dropped is the number of keys set locally that were never replayed,
+	// because too many keys were pending or bloomD refused them.
+	Dropped int64
+}
+
+// localBloom is a plain in-memory bloom filter.
+type localBloom struct {
+	bits   []uint64
+	m      uint64
+	hashes uint64
+}
+
+// newLocalBloom sizes the filter for the capacity and false positive
+// probability, like bloomD does for a filter without scaling.
+func newLocalBloom(capacity int, probability float64) *localBloom {
+	if capacity < 1 {
+		capacity = defaultLocalCapacity
+	}
+	if probability <= 0 || probability >= 1 {
+		probability = defaultLocalProbability
+	}
+
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(probability) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	hashes := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	return &localBloom{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		hashes: hashes,
+	}
+}
+
+// add sets the key and reports whether it was not already present.
+func (b *localBloom) add(key string) bool {
+	h1, h2 := bloomHashes(key)
+	added := false
+	for i := uint64(0); i < b.hashes; i++ {
+		bit := (h1 + i*h2) % b.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			b.bits[word] |= mask
+			added = true
+		}
+	}
+	return added
+}
+
+func (b *localBloom) has(key string) bool {
+	h1, h2 := bloomHashes(key)
+	for i := uint64(0); i < b.hashes; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes returns the two hashes the bit positions are derived from.
+func bloomHashes(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	io.WriteString(h, key)
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+type localFilter struct {
+	bloom   *localBloom
+	pending []string
+}
+
+type localSize struct {
+	capacity    int
+	probability float64
+}
+
+// localFallback serves sets and checks from in-memory filters while bloomD
+// cannot be reached, and replays the keys set locally once it is back.
+type localFallback struct {
+	// Accessed atomically, keep at the top for alignment.
+	pendingKeys int64
+
+	client     *Client
+	maxPending int
+
+	mu        sync.Mutex
+	filters   map[string]*localFilter
+	sizes     map[string]localSize
+	stats     LocalFallbackStats
+	replaying bool
+	closed    bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newLocalFallback returns a local fallback whose client must be set before
+// any key is set.
+func newLocalFallback(maxPending int) *localFallback {
+	return &localFallback{
+		maxPending: maxPending,
+		filters:    make(map[string]*localFilter),
+		sizes:      make(map[string]localSize),
+		stop:       make(chan struct{}),
+	}
+}
+
+// learn remembers the parameters of a filter, to size its local filter.
+func (l *localFallback) learn(name string, capacity int, probability float64) {
+	if capacity < 1 || probability <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sizes[name] = localSize{capacity: capacity, probability: probability}
+}
+
+// set adds the keys to the local filter, keeping them for replay unless they
+// are replayed some other way.
+func (l *localFallback) set(name string, replay bool, keys ...string) []bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	filter, ok := l.filters[name]
+	if !ok {
+		size, ok := l.sizes[name]
+		if !ok {
+			size = localSize{capacity: defaultLocalCapacity, probability: defaultLocalProbability}
+		}
+		filter = &localFilter{bloom: newLocalBloom(size.capacity, size.probability)}
+		l.filters[name] = filter
+	}
+
+	added := make([]bool, len(keys))
+	for i, key := range keys {
+		added[i] = filter.bloom.add(key)
+		l.stats.Sets++
+
+		if !added[i] || !replay {
+			continue
+		}
+		if int(atomic.LoadInt64(&l.pendingKeys)) >= l.maxPending {
+			l.stats.Dropped++
+			continue
+		}
+		filter.pending = append(filter.pending, key)
+		atomic.AddInt64(&l.pendingKeys, 1)
+	}
+	return added
+}
+
+// check reports which keys were set locally.
+func (l *localFallback) check(name string, keys ...string) []bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	present := make([]bool, len(keys))
+	filter, ok := l.filters[name]
+	for i, key := range keys {
+		present[i] = ok && filter.bloom.has(key)
+		l.stats.Checks++
+	}
+	return present
+}
+
+// forget discards the local filter, e.g. when the filter is dropped.
+func (l *localFallback) forget(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if filter, ok := l.filters[name]; ok {
+		atomic.AddInt64(&l.pendingKeys, -int64(len(filter.pending)))
+		delete(l.filters, name)
+	}
+	delete(l.sizes, name)
+}
+
+// resume starts replaying the pending keys, unless there are none or a replay
+// is already running. Called whenever bloomD is known to be reachable.
+func (l *localFallback) resume() {
+	if atomic.LoadInt64(&l.pendingKeys) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.replaying || l.closed {
+		return
+	}
+	l.replaying = true
+	l.wg.Add(1)
+	go l.replay()
+}
+
+// replay bulk sets the pending keys of every filter, one filter at a time,
+// until none is left or bloomD cannot be reached again.
+func (l *localFallback) replay() {
+	defer l.wg.Done()
+
+	for {
+		name, keys := l.take()
+		if keys == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultLocalReplayTimeout)
+		go func() {
+			select {
+			case <-l.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		_, err := l.client.sendBatchReprovisioned(ctx, _BULK, name, keys)
+		cancel()
+
+		if !l.replayed(name, keys, err) {
+			return
+		}
+	}
+}
+
+// take returns the pending keys of a filter. It returns none, marking the
+// replay as finished in the same critical section, when there is nothing left.
+func (l *localFallback) take() (string, []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		for name, filter := range l.filters {
+			if len(filter.pending) == 0 {
+				continue
+			}
+			keys := filter.pending
+			filter.pending = nil
+			return name, keys
+		}
+	}
+
+	l.replaying = false
+	return "", nil
+}
+
+// replayed accounts for the outcome of replaying the keys and reports whether
+// to go on with the next filter.
+func (l *localFallback) replayed(name string, keys []string, err error) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	filter, ok := l.filters[name]
+	if err != nil && (l.closed || isUnavailable(err)) {
+		if ok && !l.closed {
+			filter.pending = append(keys, filter.pending...)
+		} else {
+			atomic.AddInt64(&l.pendingKeys, -int64(len(keys)))
+		}
+		l.replaying = false
+		return false
+	}
+
+	atomic.AddInt64(&l.pendingKeys, -int64(len(keys)))
+	if err != nil {
+		l.stats.Dropped += int64(len(keys))
+	} else {
+		l.stats.Replayed += int64(len(keys))
+	}
+
+	// Once everything set locally is on bloomD, it answers for these keys.
+	if ok && len(filter.pending) == 0 {
+		delete(l.filters, name)
+	}
+	return true
+}
+
+func (l *localFallback) snapshot() LocalFallbackStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.stats
+	stats.Filters = len(l.filters)
+	stats.Pending = int(atomic.LoadInt64(&l.pendingKeys))
+	return stats
+}
+
+// close stops the replay. Keys still pending are lost.
+func (l *localFallback) close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.stop)
+	l.mu.Unlock()
+
+	l.wg.Wait()
+}
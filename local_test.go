@@ -0,0 +1,101 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBloom(t *testing.T) {
+	assert := assert.New(t)
+
+	bloom := newLocalBloom(1000, 0.01)
+	assert.Equal(uint64(9586), bloom.m)
+	assert.Equal(uint64(7), bloom.hashes)
+
+	// A new key may already look present once the filter fills up.
+	added := 0
+	for i := 0; i < 1000; i++ {
+		if bloom.add(fmt.Sprintf("key-%d", i)) {
+			added++
+		}
+	}
+	assert.True(added > 970, "%d keys added", added)
+	assert.False(bloom.add("key-0"))
+
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		assert.True(bloom.has(fmt.Sprintf("key-%d", i)))
+		if bloom.has(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.True(falsePositives < 30, "%d false positives", falsePositives)
+}
+
+func TestClientLocalFallback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(),
+		WithMaxAttempts(1),
+		WithInitialConnections(1),
+		WithReconnectBackoff(time.Millisecond, 10*time.Millisecond),
+		WithFallbackPolicy(FallbackAssumePresent),
+		WithLocalFallback(2))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.CreateWithParams(ctx, "f", 1000, 0.01, false))
+	_, err = client.Info(ctx, "f")
+	assert.NoError(err)
+
+	server.Close()
+	// The pooled connection was dropped, fail it once.
+	client.Ping()
+
+	added, err := client.Set(ctx, "f", "a")
+	assert.NoError(err)
+	assert.True(added)
+	added, err = client.Set(ctx, "f", "a")
+	assert.NoError(err)
+	assert.False(added)
+
+	results, err := client.Bulk(ctx, "f", "b", "c")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true}, results)
+
+	// The local fallback takes precedence over the fallback policy.
+	results, err = client.Multi(ctx, "f", "a", "b", "d")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true, false}, results)
+	present, err := client.CheckAsync(ctx, "f", "c").Wait(ctx)
+	assert.NoError(err)
+	assert.True(present)
+
+	client.local.mu.Lock()
+	assert.Equal(uint64(9586), client.local.filters["f"].bloom.m)
+	client.local.mu.Unlock()
+
+	stats := client.LocalFallbackStats()
+	assert.Equal(1, stats.Filters)
+	assert.Equal(2, stats.Pending)
+	assert.Equal(int64(1), stats.Dropped)
+
+	assert.NoError(server.Restart())
+
+	assert.True(eventually(func() bool { return client.LocalFallbackStats().Replayed == 2 }))
+	assert.True(server.Has("f", "a"))
+	assert.True(server.Has("f", "b"))
+	assert.False(server.Has("f", "c"))
+
+	stats = client.LocalFallbackStats()
+	assert.Equal(0, stats.Filters)
+	assert.Equal(0, stats.Pending)
+	assert.Equal(int64(4), stats.Sets)
+	assert.Equal(int64(4), stats.Checks)
+}
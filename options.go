@@ -1,27 +1,98 @@
 package bloomd
 
+import (
+	"crypto/tls"
+	"time"
+)
+
 const (
-	defaultInitialConnections = 5
-	defaultHashKeys           = false
-	defaultMaxAttempts        = 3
-	defaultMaxConnections     = 10
+	defaultAliasRefresh        = 30 * time.Second
+	defaultCacheEntries        = 0
+	defaultCacheMaxStaleness   = time.Minute
+	defaultCoalesceWindow      = 0
+	defaultDialTimeout         = 10 * time.Second
+	defaultInitialConnections  = 5
+	defaultHashKeys            = false
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultIdleTimeout         = 5 * time.Minute
+	defaultLazyConnect         = false
+	defaultLocalFallbackKeys   = 0
+	defaultMaxAttempts         = 3
+	defaultMaxBatchKeys        = 1000
+	defaultMaxConnections      = 10
+	defaultMaxLifetime         = 0
+	defaultMaxLineBytes        = 64 * 1024
+	defaultNoDelay             = true
+	defaultPipelining          = false
+	defaultReconnectMaxBackoff = 30 * time.Second
+	defaultReconnectMinBackoff = 100 * time.Millisecond
 )
 
 // Option is configuration setting for the bloomD client.
 type Option func(*options)
 
 type options struct {
-	hashKeys           bool
-	initialConnections int
-	maxAttempts        int
-	maxConnections     int
+	aliasRefresh        time.Duration
+	aliasStore          AliasStore
+	auditHandler        func(AuditEvent)
+	breaker             *CircuitBreakerConfig
+	cacheEntries        int
+	cacheMaxStaleness   time.Duration
+	coalesceWindow      time.Duration
+	dialer              DialFunc
+	dialTimeout         time.Duration
+	dryRun              bool
+	dryRunHandler       func(DryRunEvent)
+	fallbackFilters     map[string]FallbackPolicy
+	fallbackHandler     func(FallbackEvent)
+	fallbackPolicy      FallbackPolicy
+	hashKeys            bool
+	healthCheckInterval time.Duration
+	healthListener      func(from, to HealthState)
+	idleTimeout         time.Duration
+	initialConnections  int
+	journal             *JournalConfig
+	keepAlive           time.Duration
+	lazyConnect         bool
+	localFallbackKeys   int
+	maxAttempts         int
+	maxBatchKeys        int
+	maxConnections      int
+	maxLifetime         time.Duration
+	maxLineBytes        int
+	noDelay             bool
+	pipelining          bool
+	protectedFilters    []string
+	readOnly            bool
+	reconnectMaxBackoff time.Duration
+	reconnectMinBackoff time.Duration
+	reprovision         bool
+	reprovisionHandler  func(ReprovisionEvent)
+	templates           []namedTemplate
+	tlsConfig           *tls.Config
 }
 
 var defaultOptions = &options{
-	initialConnections: defaultInitialConnections,
-	hashKeys:           defaultHashKeys,
-	maxAttempts:        defaultMaxAttempts,
-	maxConnections:     defaultMaxConnections,
+	aliasRefresh:        defaultAliasRefresh,
+	cacheEntries:        defaultCacheEntries,
+	cacheMaxStaleness:   defaultCacheMaxStaleness,
+	coalesceWindow:      defaultCoalesceWindow,
+	dialTimeout:         defaultDialTimeout,
+	initialConnections:  defaultInitialConnections,
+	hashKeys:            defaultHashKeys,
+	healthCheckInterval: defaultHealthCheckInterval,
+	idleTimeout:         defaultIdleTimeout,
+	lazyConnect:         defaultLazyConnect,
+	localFallbackKeys:   defaultLocalFallbackKeys,
+	maxAttempts:         defaultMaxAttempts,
+	maxBatchKeys:        defaultMaxBatchKeys,
+	maxConnections:      defaultMaxConnections,
+	maxLifetime:         defaultMaxLifetime,
+	maxLineBytes:        defaultMaxLineBytes,
+	noDelay:             defaultNoDelay,
+	pipelining:          defaultPipelining,
+	reconnectMaxBackoff: defaultReconnectMaxBackoff,
+	reconnectMinBackoff: defaultReconnectMinBackoff,
 }
 
 func evaluateOptions(opts []Option) *options {
@@ -33,6 +104,130 @@ func evaluateOptions(opts []Option) *options {
 	return optCopy
 }
 
+// WithAliases resolves logical filter names to physical filters through the
+// aliases kept in the store, so a filter can be rebuilt under another name
+// and cut over to with `SwapAlias` without changing its users. Every command
+// taking a filter name resolves it, and writes also go to the dual-write
+// filters of the alias.
+func WithAliases(store AliasStore) Option {
+	return func(o *options) {
+		o.aliasStore = store
+	}
+}
+
+// WithAliasRefresh sets how often the aliases are loaded again from the
+// store, to pick up changes made by other clients. Zero or less disables the
+// background refresh, leaving it to `ReloadAliases`. Defaults to 30s.
+func WithAliasRefresh(interval time.Duration) Option {
+	return func(o *options) {
+		o.aliasRefresh = interval
+	}
+}
+
+// WithAuditHandler registers a function called with every admin command, i.e.
+// create, drop, clear, close and flush, once it completed or was rejected. It
+// is called from the goroutine issuing the command.
+func WithAuditHandler(handler func(AuditEvent)) Option {
+	return func(o *options) {
+		o.auditHandler = handler
+	}
+}
+
+// WithCheckCoalescing merges concurrent `Check` calls against the same filter
+// issued within the window into a single multi command. Identical keys in
+// flight are only checked once. A window of zero, the default, disables it.
+func WithCheckCoalescing(window time.Duration) Option {
+	return func(o *options) {
+		o.coalesceWindow = window
+	}
+}
+
+// WithCircuitBreaker fails requests fast with ErrCircuitOpen once bloomD keeps
+// failing, instead of waiting for every dial or read to time out. After the
+// open timeout a few trial requests decide whether to close it again. Only
+// failures to reach bloomD count, error replies do not.
+func WithCircuitBreaker(config CircuitBreakerConfig) Option {
+	return func(o *options) {
+		o.breaker = &config
+	}
+}
+
+// WithDialer replaces the function used to open connections to bloomD, e.g.
+// to go through a proxy. `WithKeepAlive` has no effect on a custom dialer.
+func WithDialer(dialer DialFunc) Option {
+	return func(o *options) {
+		o.dialer = dialer
+	}
+}
+
+// WithDialTimeout bounds how long opening a connection, including the TLS
+// handshake, may take. A timeout of zero or less disables it.
+func WithDialTimeout(dialTimeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = dialTimeout
+	}
+}
+
+// WithDryRun keeps the client from changing anything on bloomD. Sets, bulks,
+// creates, drops, clears, closes and flushes are reported to the handler, or
+// logged if nil, instead of being sent, and their results are simulated from
+// the live state: a set reports the key as added unless a check finds it, and
+// a drop succeeds if the filter exists. Simulated sets are not remembered, so
+// a key set twice is reported as added twice, and are never journaled or set
+// locally while bloomD is unreachable. An existing journal is left for a
+// client that replays it for real. Reads still go to bloomD.
+func WithDryRun(handler func(DryRunEvent)) Option {
+	return func(o *options) {
+		o.dryRun = true
+		o.dryRunHandler = handler
+	}
+}
+
+// WithFallbackHandler registers a function called with every check answered
+// according to the fallback policy, including those that return the error.
+// It is called from the goroutine making the check, so it should return
+// quickly.
+func WithFallbackHandler(handler func(FallbackEvent)) Option {
+	return func(o *options) {
+		o.fallbackHandler = handler
+	}
+}
+
+// WithFallbackPolicy sets what `Check` and `Multi` return when bloomD cannot be
+// reached, e.g. it is down or the circuit breaker is open. Error replies from
+// bloomD are always returned. Defaults to FallbackError.
+func WithFallbackPolicy(policy FallbackPolicy) Option {
+	return func(o *options) {
+		o.fallbackPolicy = policy
+	}
+}
+
+// WithFilterFallbackPolicy overrides the fallback policy for a single filter.
+func WithFilterFallbackPolicy(name string, policy FallbackPolicy) Option {
+	return func(o *options) {
+		filters := make(map[string]FallbackPolicy, len(o.fallbackFilters)+1)
+		for filter, p := range o.fallbackFilters {
+			filters[filter] = p
+		}
+		filters[name] = policy
+		o.fallbackFilters = filters
+	}
+}
+
+// WithFilterTemplate registers the parameters `Set`, `Bulk` and their async
+// variants create a missing filter with, before retrying the write once. The
+// pattern is either a filter name or a `path.Match` pattern, e.g. "events-*".
+// A template for the exact name wins, otherwise the first matching pattern
+// registered is used.
+// Filters without a template are never created implicitly.
+func WithFilterTemplate(pattern string, template FilterTemplate) Option {
+	return func(o *options) {
+		templates := make([]namedTemplate, len(o.templates), len(o.templates)+1)
+		copy(templates, o.templates)
+		o.templates = append(templates, namedTemplate{pattern: pattern, template: template})
+	}
+}
+
 // WithHashKeys forces keys to be hashed before being sent to the bloomD.
 func WithHashKeys(hashKeys bool) Option {
 	return func(o *options) {
@@ -40,6 +235,32 @@ func WithHashKeys(hashKeys bool) Option {
 	}
 }
 
+// WithHealthCheckInterval sets how often idle connections are checked with a
+// cheap command, closing those that fail. Zero or less disables the checks.
+func WithHealthCheckInterval(healthCheckInterval time.Duration) Option {
+	return func(o *options) {
+		o.healthCheckInterval = healthCheckInterval
+	}
+}
+
+// WithHealthListener registers a function called on every change of the
+// client health state. Calls are made in order, from the goroutine that
+// observed the change, so the function should return quickly.
+func WithHealthListener(listener func(from, to HealthState)) Option {
+	return func(o *options) {
+		o.healthListener = listener
+	}
+}
+
+// WithIdleTimeout sets how long a connection may sit idle in the pool before
+// it is closed. The pool keeps at least the initial number of connections.
+// Zero or less keeps idle connections forever.
+func WithIdleTimeout(idleTimeout time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = idleTimeout
+	}
+}
+
 // WithInitialConnections sets the number of connections the pool will be
 // initialized with.
 func WithInitialConnections(initialConnections int) Option {
@@ -48,6 +269,47 @@ func WithInitialConnections(initialConnections int) Option {
 	}
 }
 
+// WithJournal writes the sets and bulks that fail to reach bloomD to an
+// on-disk journal, and returns ErrJournaled for them instead of the error. A
+// background replayer sends the journaled keys in order once bloomD is back,
+// and a client opening the same journal later replays what is left.
+func WithJournal(config JournalConfig) Option {
+	return func(o *options) {
+		o.journal = &config
+	}
+}
+
+// WithKeepAlive sets the TCP keep-alive period of the connections. Zero uses
+// the system default and a negative value disables keep-alives.
+func WithKeepAlive(keepAlive time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = keepAlive
+	}
+}
+
+// WithLazyConnect makes `NewClient` succeed without waiting for any
+// connection. The initial connections are opened in the background instead,
+// and if bloomD is down the client turns Down and reconnects in the
+// background.
+func WithLazyConnect(lazyConnect bool) Option {
+	return func(o *options) {
+		o.lazyConnect = lazyConnect
+	}
+}
+
+// WithLocalFallback serves `Set`, `Bulk`, `Check` and `Multi` from in-memory
+// bloom filters while bloomD cannot be reached, taking precedence over
+// `WithFallbackPolicy`. Local filters are sized from the last parameters seen
+// by `Info` or `CreateWithParams`, or bloomD defaults otherwise. Checks only
+// see keys set locally. Once bloomD is back, up to maxPendingKeys keys set
+// locally are replayed with bulk commands. Zero or less, the default,
+// disables it.
+func WithLocalFallback(maxPendingKeys int) Option {
+	return func(o *options) {
+		o.localFallbackKeys = maxPendingKeys
+	}
+}
+
 // WithMaxAttempts sets the number of retries the client will do if an error
 // occurs when communicating with bloomD.
 func WithMaxAttempts(maxAttempts int) Option {
@@ -56,10 +318,120 @@ func WithMaxAttempts(maxAttempts int) Option {
 	}
 }
 
+// WithMaxBatchKeys sets the maximum number of keys sent in a single bulk or
+// multi command. Larger requests are split into several commands. A value of
+// zero or less disables the limit.
+func WithMaxBatchKeys(maxBatchKeys int) Option {
+	return func(o *options) {
+		o.maxBatchKeys = maxBatchKeys
+	}
+}
+
 // WithMaxConnections sets the number of maximum connections the pool will have
-// at any given time.
+// at any given time. Requests wait, up to their context deadline, for a
+// connection when all of them are in use.
 func WithMaxConnections(maxConnections int) Option {
 	return func(o *options) {
 		o.maxConnections = maxConnections
 	}
 }
+
+// WithMaxLifetime sets how long a connection may be used before it is closed
+// and replaced. Zero or less keeps connections forever.
+func WithMaxLifetime(maxLifetime time.Duration) Option {
+	return func(o *options) {
+		o.maxLifetime = maxLifetime
+	}
+}
+
+// WithMaxLineBytes sets the maximum length, in bytes, of a single bulk or
+// multi command line including the trailing newline. Larger requests are split
+// into several commands. A value of zero or less disables the limit.
+func WithMaxLineBytes(maxLineBytes int) Option {
+	return func(o *options) {
+		o.maxLineBytes = maxLineBytes
+	}
+}
+
+// WithNoDelay sets TCP_NODELAY on the connections, disabling Nagle's
+// algorithm. Enabled by default.
+func WithNoDelay(noDelay bool) Option {
+	return func(o *options) {
+		o.noDelay = noDelay
+	}
+}
+
+// WithPipelining makes the client send every chunk of a split bulk or multi
+// request over a single connection, instead of spreading the chunks across the
+// pool concurrently.
+func WithPipelining(pipelining bool) Option {
+	return func(o *options) {
+		o.pipelining = pipelining
+	}
+}
+
+// WithPositiveCache keeps up to maxEntries keys known to be present in their
+// filter, answering repeated checks without a round trip to bloomD. Entries
+// are dropped when this client clears, drops or closes the filter, and expire
+// after maxStaleness to bound how long a clear issued by another client goes
+// unnoticed. A maxStaleness of zero or less never expires entries.
+func WithPositiveCache(maxEntries int, maxStaleness time.Duration) Option {
+	return func(o *options) {
+		o.cacheEntries = maxEntries
+		o.cacheMaxStaleness = maxStaleness
+	}
+}
+
+// WithReconnectBackoff sets the delay between the background reconnection
+// attempts while bloomD is down. The delay starts at min and doubles after
+// every failed attempt, up to max.
+func WithReconnectBackoff(min, max time.Duration) Option {
+	return func(o *options) {
+		o.reconnectMinBackoff = min
+		o.reconnectMaxBackoff = max
+	}
+}
+
+// WithProtectedFilters protects the filters, by name or `path.Match` pattern,
+// so `Drop` and `Clear` fail with ErrProtectedFilter unless called with a
+// context from `OverrideProtection`. Names are matched both as called and as
+// resolved through aliases.
+func WithProtectedFilters(patterns ...string) Option {
+	return func(o *options) {
+		protected := make([]string, len(o.protectedFilters), len(o.protectedFilters)+len(patterns))
+		copy(protected, o.protectedFilters)
+		o.protectedFilters = append(protected, patterns...)
+	}
+}
+
+// WithReadOnly rejects the commands changing bloomD, i.e. sets, bulks,
+// creates, drops, clears, closes and flushes, with ErrReadOnly. Checks, infos
+// and lists still go through. An existing journal is not replayed.
+func WithReadOnly(readOnly bool) Option {
+	return func(o *options) {
+		o.readOnly = readOnly
+	}
+}
+
+// WithReprovisioning makes the client create again the filters it created,
+// with the same parameters, when bloomD lost them, e.g. an `in_memory` filter
+// after a restart. A `Set`, `Bulk`, `Check`, `Multi` or `Info` failing with
+// FilterDoesNotExist on such a filter is retried once the filter is back.
+// The handler, if not nil, is called when a filter is recreated and when
+// `Info` sees the counters of a filter go backwards, so the application can
+// load the lost keys again.
+func WithReprovisioning(handler func(ReprovisionEvent)) Option {
+	return func(o *options) {
+		o.reprovision = true
+		o.reprovisionHandler = handler
+	}
+}
+
+// WithTLS wraps every connection in TLS using the config, e.g. for bloomD
+// running behind stunnel. If the config has no ServerName, the host of the
+// address is used.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
@@ -48,6 +48,8 @@ func parseBool(resp string) (bool, error) {
 		return true, nil
 	case _RESPONSE_NO:
 		return false, nil
+	case _RESPONSE_FILTER_NOT_EXIST:
+		return false, FilterDoesNotExist
 	default:
 		return false, errors.New(resp)
 	}
@@ -75,6 +77,8 @@ func parseConfirmation(resp string) error {
 	switch resp {
 	case _RESPONSE_DONE:
 		return nil
+	case _RESPONSE_FILTER_NOT_EXIST:
+		return FilterDoesNotExist
 	default:
 		return errors.New(resp)
 	}
@@ -113,6 +117,10 @@ func parseCreate(resp string) error {
 
 // parseInfo converts the response into VerboseBloomFilter.
 func parseInfo(name, resp string) (VerboseBloomFilter, error) {
+	if resp == _RESPONSE_FILTER_NOT_EXIST {
+		return VerboseBloomFilter{}, FilterDoesNotExist
+	}
+
 	lines := strings.Split(resp, "\n")
 
 	properties := make(map[string]int)
@@ -161,6 +169,10 @@ func parseInfo(name, resp string) (VerboseBloomFilter, error) {
 
 // parseFilterList converts the response into a list of BloomFilter.
 func parseFilterList(resp string) ([]BloomFilter, error) {
+	if resp == "" {
+		return []BloomFilter{}, nil
+	}
+
 	lines := strings.Split(resp, "\n")
 
 	results := make([]BloomFilter, len(lines))
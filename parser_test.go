@@ -17,6 +17,9 @@ func TestParseBool(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(false, res)
 
+	_, err = parseBool("Filter does not exist")
+	assert.Equal(FilterDoesNotExist, err)
+
 	res, err = parseBool("Wrong answer")
 	assert.Error(err)
 	assert.Equal(false, res)
@@ -53,7 +56,7 @@ func TestParseConfirmation(t *testing.T) {
 	assert.NoError(err)
 
 	err = parseConfirmation("Filter does not exist")
-	assert.Error(err)
+	assert.Equal(FilterDoesNotExist, err)
 
 	err = parseConfirmation("Filter is not proxied. Close it first.")
 	assert.Error(err)
@@ -118,6 +121,9 @@ func TestParseInfo(t *testing.T) {
 
 	filter, err = parseInfo("Filtero", "garbage")
 	assert.Error(err)
+
+	_, err = parseInfo("Filtero", "Filter does not exist")
+	assert.Equal(FilterDoesNotExist, err)
 }
 
 func TestParseFilterList(t *testing.T) {
@@ -0,0 +1,162 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPipelineDepth   = 128
+	defaultPipelineTimeout = 5 * time.Second
+)
+
+// pipelineRequest is a single command waiting to be pipelined.
+type pipelineRequest struct {
+	ctx  context.Context
+	cmd  string
+	done func(resp string, err error)
+}
+
+// pipeliner sends queued commands in pipelined groups. Each worker takes
+// every command waiting in the queue, up to the pipeline depth, and sends them
+// over a single connection, so requests issued close together share it.
+type pipeliner struct {
+	client  *Client
+	workers int
+	depth   int
+
+	startOnce sync.Once
+	mu        sync.RWMutex
+	closed    bool
+	queue     chan *pipelineRequest
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newPipeliner(client *Client, workers int) *pipeliner {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &pipeliner{
+		client:  client,
+		workers: workers,
+		depth:   defaultPipelineDepth,
+		queue:   make(chan *pipelineRequest, workers*defaultPipelineDepth),
+		stop:    make(chan struct{}),
+	}
+}
+
+// submit queues the request. The workers are only started once the first
+// request comes in.
+func (p *pipeliner) submit(req *pipelineRequest) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		req.done("", ErrClientShutdown)
+		return
+	} else if err := req.ctx.Err(); err != nil {
+		req.done("", err)
+		return
+	}
+
+	p.startOnce.Do(p.start)
+
+	select {
+	case p.queue <- req:
+	case <-req.ctx.Done():
+		req.done("", req.ctx.Err())
+	}
+}
+
+// close stops the workers and fails every request still queued.
+func (p *pipeliner) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	p.wg.Wait()
+
+	for {
+		select {
+		case req := <-p.queue:
+			req.done("", ErrClientShutdown)
+		default:
+			return
+		}
+	}
+}
+
+func (p *pipeliner) start() {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+func (p *pipeliner) work() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case req := <-p.queue:
+			p.send(p.drain(req))
+		}
+	}
+}
+
+// drain collects the requests already waiting behind the first one.
+func (p *pipeliner) drain(first *pipelineRequest) []*pipelineRequest {
+	reqs := []*pipelineRequest{first}
+	for len(reqs) < p.depth {
+		select {
+		case req := <-p.queue:
+			reqs = append(reqs, req)
+		default:
+			return reqs
+		}
+	}
+	return reqs
+}
+
+// send pipelines the requests whose context is still alive over a single
+// connection.
+func (p *pipeliner) send(reqs []*pipelineRequest) {
+	live := reqs[:0]
+	for _, req := range reqs {
+		if err := req.ctx.Err(); err != nil {
+			req.done("", err)
+		} else {
+			live = append(live, req)
+		}
+	}
+
+	if len(live) == 0 {
+		return
+	}
+
+	cmds := make([]string, len(live))
+	for i, req := range live {
+		cmds[i] = req.cmd
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPipelineTimeout)
+	defer cancel()
+
+	resps, err := p.client.sendPipeline(ctx, cmds)
+	for i, req := range live {
+		if err != nil {
+			req.done("", err)
+		} else {
+			req.done(resps[i], nil)
+		}
+	}
+}
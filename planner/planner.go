@@ -0,0 +1,232 @@
+// Package planner sizes bloomD filters and estimates the false positive rate
+// of live ones.
+//
+// bloomD filters are scalable: a filter is a chain of layers, each with
+// `ScaleSize` times the capacity of the previous one and `Reduction` times its
+// false positive probability. The first layer gets the configured probability
+// times (1 - `Reduction`), so the probabilities of all layers add up to at
+// most the configured one. The estimates follow that model and the textbook
+// bloom filter formulas, so they are approximations.
+package planner
+
+import (
+	"math"
+
+	bloomd "github.com/eduardoramirez/go-bloomd"
+	"github.com/pkg/errors"
+)
+
+// maxLayers bounds the number of layers considered for a filter.
+const maxLayers = 32
+
+// Config describes how bloomD scales filters.
+type Config struct {
+	// ScaleSize is how much larger the capacity of every new layer is.
+	ScaleSize float64
+	// Reduction is the ratio the probability of every new layer is multiplied
+	// by.
+	Reduction float64
+	// HeaderBytes is the storage used by every layer besides its bits.
+	HeaderBytes int64
+}
+
+// Defaults matches the bloomD defaults.
+var Defaults = Config{
+	ScaleSize:   4,
+	Reduction:   0.9,
+	HeaderBytes: 512,
+}
+
+// Plan is the recommended configuration of a filter.
+type Plan struct {
+	// Capacity and Probability are the parameters for `CreateWithParams`.
+	Capacity    int
+	Probability float64
+	// Bits and Hashes describe the first layer.
+	Bits   uint64
+	Hashes int
+	// StorageBytes is the predicted storage of the filter once full.
+	StorageBytes int64
+}
+
+// Estimate is the estimated state of a live filter.
+type Estimate struct {
+	Filter string
+	// Layers is the number of layers the filter scaled to.
+	Layers int
+	// InitialCapacity is the capacity of the first layer.
+	InitialCapacity int
+	Size            int
+	Capacity        int
+	// Fill is the size over the capacity.
+	Fill float64
+	// FalsePositiveRate is the estimated rate of false positives.
+	FalsePositiveRate float64
+	Target            float64
+	// Degraded reports whether the rate exceeds the target.
+	Degraded bool
+}
+
+// Recommend sizes a filter for the expected number of elements and target
+// false positive rate, see `Config.Recommend`.
+func Recommend(elements int, probability float64, growth float64) (Plan, error) {
+	return Defaults.Recommend(elements, probability, growth)
+}
+
+// Recommend sizes a filter for the expected number of elements grown by the
+// growth factor, e.g. 1.5 for 50% more over its lifetime, so it never has to
+// scale. A growth below 1 counts as 1.
+func (c Config) Recommend(elements int, probability float64, growth float64) (Plan, error) {
+	if elements < 1 || probability <= 0 || probability >= 1 {
+		return Plan{}, errors.New("planner: invalid elements/probability")
+	}
+	if growth < 1 {
+		growth = 1
+	}
+
+	capacity := int(math.Ceil(float64(elements) * growth))
+	p := c.layerProbability(probability, 0)
+	bits := layerBits(capacity, p)
+	return Plan{
+		Capacity:     capacity,
+		Probability:  probability,
+		Bits:         bits,
+		Hashes:       layerHashes(bits, capacity),
+		StorageBytes: c.layerBytes(bits),
+	}, nil
+}
+
+// Storage predicts the storage in bytes of a filter created with the capacity
+// and probability once it holds the elements, including the layers it scales
+// to.
+func (c Config) Storage(capacity int, probability float64, elements int) int64 {
+	var storage int64
+	for i, layer := 0, capacity; i < maxLayers; i++ {
+		storage += c.layerBytes(layerBits(layer, c.layerProbability(probability, i)))
+		elements -= layer
+		if elements <= 0 {
+			break
+		}
+		layer = int(float64(layer) * c.ScaleSize)
+	}
+	return storage
+}
+
+// EstimateFilter estimates the false positive rate of a live filter, see
+// `Config.Estimate`.
+func EstimateFilter(info bloomd.VerboseBloomFilter, target float64) Estimate {
+	return Defaults.Estimate(info, target)
+}
+
+// Estimate estimates the false positive rate of a live filter from its info.
+// The number of layers is the one whose predicted storage is closest to the
+// reported storage. The filter is degraded once the rate exceeds the target,
+// or the probability it was created with when the target is zero.
+func (c Config) Estimate(info bloomd.VerboseBloomFilter, target float64) Estimate {
+	if target <= 0 {
+		target = float64(info.Probability)
+	}
+
+	e := Estimate{
+		Filter:   info.Name,
+		Size:     info.Size,
+		Capacity: info.Capacity,
+		Target:   target,
+	}
+	if info.Capacity > 0 {
+		e.Fill = float64(info.Size) / float64(info.Capacity)
+	}
+
+	capacities := c.layers(info)
+	if len(capacities) == 0 {
+		return e
+	}
+	e.Layers = len(capacities)
+	e.InitialCapacity = capacities[0]
+
+	// Layers are filled in order, the newest one taking any excess.
+	absent := 1.0
+	remaining := info.Size
+	for i, capacity := range capacities {
+		n := remaining
+		if n > capacity && i < len(capacities)-1 {
+			n = capacity
+		}
+		remaining -= n
+
+		bits := layerBits(capacity, c.layerProbability(float64(info.Probability), i))
+		absent *= 1 - layerRate(bits, layerHashes(bits, capacity), n)
+	}
+	e.FalsePositiveRate = 1 - absent
+	e.Degraded = e.FalsePositiveRate > target
+	return e
+}
+
+// layers returns the capacity of every layer of the filter.
+func (c Config) layers(info bloomd.VerboseBloomFilter) []int {
+	if info.Capacity < 1 || info.Probability <= 0 {
+		return nil
+	}
+
+	var best []int
+	bestDiff := int64(math.MaxInt64)
+	for n := 1; n <= maxLayers; n++ {
+		// The capacities form a geometric series adding up to the capacity.
+		total := (math.Pow(c.ScaleSize, float64(n)) - 1) / (c.ScaleSize - 1)
+		initial := int(math.Round(float64(info.Capacity) / total))
+		if initial < 1 {
+			break
+		}
+
+		capacities := make([]int, n)
+		var storage int64
+		for i, layer := 0, initial; i < n; i++ {
+			capacities[i] = layer
+			storage += c.layerBytes(layerBits(layer, c.layerProbability(float64(info.Probability), i)))
+			layer = int(float64(layer) * c.ScaleSize)
+		}
+
+		diff := storage - int64(info.Storage)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < bestDiff {
+			best, bestDiff = capacities, diff
+		}
+	}
+	return best
+}
+
+// layerProbability returns the probability of the layer of a filter created
+// with the probability.
+func (c Config) layerProbability(probability float64, layer int) float64 {
+	return probability * (1 - c.Reduction) * math.Pow(c.Reduction, float64(layer))
+}
+
+func (c Config) layerBytes(bits uint64) int64 {
+	return int64((bits+7)/8) + c.HeaderBytes
+}
+
+// layerBits returns the number of bits for the capacity and probability,
+// -n ln(p) / ln(2)².
+func layerBits(capacity int, probability float64) uint64 {
+	return uint64(math.Ceil(-float64(capacity) * math.Log(probability) / (math.Ln2 * math.Ln2)))
+}
+
+// layerHashes returns the optimal number of hashes, m/n ln(2).
+func layerHashes(bits uint64, capacity int) int {
+	hashes := int(math.Round(float64(bits) / float64(capacity) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return hashes
+}
+
+// layerRate returns the false positive rate of a layer holding n elements,
+// (1 - e^(-kn/m))^k.
+func layerRate(bits uint64, hashes int, n int) float64 {
+	if n <= 0 || bits == 0 {
+		return 0
+	}
+	return math.Pow(1-math.Exp(-float64(hashes)*float64(n)/float64(bits)), float64(hashes))
+}
@@ -0,0 +1,73 @@
+package planner
+
+import (
+	"testing"
+
+	bloomd "github.com/eduardoramirez/go-bloomd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommend(t *testing.T) {
+	assert := assert.New(t)
+
+	plan, err := Recommend(1000000, 0.001, 1.5)
+	assert.NoError(err)
+	assert.Equal(1500000, plan.Capacity)
+	assert.Equal(0.001, plan.Probability)
+	// The first layer gets a tenth of the probability, 0.0001.
+	assert.Equal(uint64(28755176), plan.Bits)
+	assert.Equal(13, plan.Hashes)
+	assert.Equal(int64(28755176/8+512), plan.StorageBytes)
+	assert.Equal(plan.StorageBytes, Defaults.Storage(plan.Capacity, plan.Probability, 1000000))
+
+	// Scaling past the capacity adds larger layers.
+	assert.True(Defaults.Storage(1000, 0.001, 1001) > 4*Defaults.Storage(1000, 0.001, 1000))
+
+	_, err = Recommend(0, 0.001, 1)
+	assert.Error(err)
+	_, err = Recommend(10, 1, 1)
+	assert.Error(err)
+}
+
+func TestEstimate(t *testing.T) {
+	assert := assert.New(t)
+
+	info := func(capacity int, size int, storage int64) bloomd.VerboseBloomFilter {
+		return bloomd.VerboseBloomFilter{BloomFilter: bloomd.BloomFilter{
+			Name:        "users",
+			Capacity:    capacity,
+			Probability: 0.001,
+			Size:        size,
+			Storage:     int(storage),
+		}}
+	}
+
+	// A full single layer is close to its own probability, well within the
+	// target.
+	single := Defaults.Storage(100000, 0.001, 100000)
+	e := EstimateFilter(info(100000, 100000, single), 0)
+	assert.Equal(1, e.Layers)
+	assert.Equal(100000, e.InitialCapacity)
+	assert.Equal(1.0, e.Fill)
+	assert.InDelta(0.0001, e.FalsePositiveRate, 0.00002)
+	assert.False(e.Degraded)
+
+	half := EstimateFilter(info(100000, 50000, single), 0)
+	assert.True(half.FalsePositiveRate < e.FalsePositiveRate)
+
+	// A filter that scaled once adds the rate of its second layer.
+	scaled := Defaults.Storage(100000, 0.001, 500000)
+	e = EstimateFilter(info(500000, 500000, scaled), 0)
+	assert.Equal(2, e.Layers)
+	assert.Equal(100000, e.InitialCapacity)
+	assert.InDelta(0.00019, e.FalsePositiveRate, 0.00003)
+	assert.False(e.Degraded)
+	assert.True(EstimateFilter(info(500000, 500000, scaled), 0.0001).Degraded)
+
+	// Overfilling a layer degrades it past the target.
+	e = EstimateFilter(info(100000, 2000000, single), 0)
+	assert.True(e.FalsePositiveRate > 0.001)
+	assert.True(e.Degraded)
+
+	assert.Equal(0, EstimateFilter(info(0, 0, 0), 0).Layers)
+}
@@ -0,0 +1,431 @@
+package bloomd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// minMaintenanceInterval bounds how often the pool looks for expired
+// connections.
+const minMaintenanceInterval = 100 * time.Millisecond
+
+// PoolStats is a snapshot of the connection pool.
+type PoolStats struct {
+	Open    int // Connections currently open, idle or in use.
+	Idle    int
+	InUse   int
+	Waiting int // Requests currently waiting for a connection.
+
+	Dials             int64
+	DialErrors        int64
+	Waits             int64 // Requests that had to wait for a connection.
+	WaitDuration      time.Duration
+	ClosedIdle        int64 // Closed after sitting idle for too long.
+	ClosedLifetime    int64 // Closed after reaching their maximum lifetime.
+	ClosedHealthCheck int64 // Closed after failing a health check.
+	ClosedErrored     int64 // Closed after an error while in use.
+}
+
+// poolClosed is handed to the requests waiting for a connection when the pool
+// is closed.
+var poolClosed = &poolConn{}
+
+// poolConn is a pooled connection and its bookkeeping.
+type poolConn struct {
+	net.Conn
+	createdAt time.Time
+	lastUsed  time.Time
+}
+
+// connPool is a bounded pool of connections to bloomD. Getting a connection
+// blocks, up to the context deadline, while every connection is in use.
+// Connections are closed when returned with an error, when idle for too long,
+// when older than their maximum lifetime or when failing a health check.
+type connPool struct {
+	dial           func(ctx context.Context) (net.Conn, error)
+	healthCheck    func(conn net.Conn) error
+	maxConns       int
+	minIdle        int
+	idleTimeout    time.Duration
+	maxLifetime    time.Duration
+	healthInterval time.Duration
+
+	mu         sync.Mutex
+	idle       []*poolConn
+	open       int
+	waiters    []chan *poolConn
+	closed     bool
+	lastHealth time.Time
+	stats      PoolStats
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type poolConfig struct {
+	maxConns       int
+	minIdle        int
+	idleTimeout    time.Duration
+	maxLifetime    time.Duration
+	healthInterval time.Duration
+}
+
+func newConnPool(dial func(ctx context.Context) (net.Conn, error), healthCheck func(net.Conn) error, cfg poolConfig) *connPool {
+	if cfg.maxConns < 1 {
+		cfg.maxConns = 1
+	}
+
+	p := &connPool{
+		dial:           dial,
+		healthCheck:    healthCheck,
+		maxConns:       cfg.maxConns,
+		minIdle:        cfg.minIdle,
+		idleTimeout:    cfg.idleTimeout,
+		maxLifetime:    cfg.maxLifetime,
+		healthInterval: cfg.healthInterval,
+		lastHealth:     time.Now(),
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+
+	go p.maintain()
+
+	return p
+}
+
+// fill dials connections until n are idle, or the pool is full. It never
+// waits for a connection in use.
+func (p *connPool) fill(ctx context.Context, n int) error {
+	conns := make([]*poolConn, 0, n)
+	var err error
+	for i := 0; i < n && p.available(); i++ {
+		var pc *poolConn
+		if pc, err = p.get(ctx); err != nil {
+			break
+		}
+		conns = append(conns, pc)
+	}
+
+	for _, pc := range conns {
+		p.put(pc, nil)
+	}
+
+	return err
+}
+
+// available reports whether get would return without waiting.
+func (p *connPool) available() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed || len(p.idle) > 0 || p.open < p.maxConns
+}
+
+// get returns an idle connection, dials a new one if the pool is not full, or
+// waits for a connection to be returned.
+func (p *connPool) get(ctx context.Context) (*poolConn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClientShutdown
+	}
+
+	now := time.Now()
+	for len(p.idle) > 0 {
+		pc := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.expired(pc, now) {
+			p.stats.ClosedLifetime++
+			p.closeLocked(pc)
+			continue
+		}
+
+		p.mu.Unlock()
+		return pc, nil
+	}
+
+	if p.open < p.maxConns {
+		p.open++
+		p.mu.Unlock()
+		return p.dialConn(ctx)
+	}
+
+	ch := make(chan *poolConn, 1)
+	p.waiters = append(p.waiters, ch)
+	p.stats.Waits++
+	p.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		p.mu.Lock()
+		p.stats.WaitDuration += time.Since(start)
+		p.mu.Unlock()
+	}()
+
+	select {
+	case pc := <-ch:
+		return p.received(ctx, pc)
+
+	case <-ctx.Done():
+		p.mu.Lock()
+		removed := p.removeWaiterLocked(ch)
+		p.mu.Unlock()
+
+		if !removed {
+			// A connection, or the right to dial one, was already handed
+			// over. Give it back.
+			switch pc := <-ch; pc {
+			case poolClosed:
+			case nil:
+				p.release()
+			default:
+				p.put(pc, nil)
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// received handles what a waiter was handed: a connection, poolClosed, or nil
+// meaning a slot was freed and the waiter may dial.
+func (p *connPool) received(ctx context.Context, pc *poolConn) (*poolConn, error) {
+	if pc == poolClosed {
+		return nil, ErrClientShutdown
+	} else if pc != nil {
+		return pc, nil
+	}
+
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+
+	if closed {
+		p.release()
+		return nil, ErrClientShutdown
+	}
+	return p.dialConn(ctx)
+}
+
+// dialConn opens a connection for a slot already accounted for in open.
+func (p *connPool) dialConn(ctx context.Context) (*poolConn, error) {
+	conn, err := p.dial(ctx)
+
+	p.mu.Lock()
+	p.stats.Dials++
+	if err != nil {
+		p.stats.DialErrors++
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+
+	now := time.Now()
+	return &poolConn{Conn: conn, createdAt: now, lastUsed: now}, nil
+}
+
+// put returns the connection to the pool. A connection returned with an
+// error is closed, since it may be left in the middle of a response.
+func (p *connPool) put(pc *poolConn, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.lastUsed = time.Now()
+
+	switch {
+	case err != nil:
+		p.stats.ClosedErrored++
+	case p.closed:
+	case p.expired(pc, pc.lastUsed):
+		p.stats.ClosedLifetime++
+	default:
+		if len(p.waiters) > 0 {
+			ch := p.waiters[0]
+			p.waiters = p.waiters[1:]
+			ch <- pc
+			return
+		}
+		p.idle = append(p.idle, pc)
+		return
+	}
+
+	p.closeLocked(pc)
+}
+
+// release gives up a slot that has no connection, handing it to a waiter if
+// there is one.
+func (p *connPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.releaseLocked()
+}
+
+func (p *connPool) releaseLocked() {
+	if len(p.waiters) > 0 {
+		ch := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		ch <- nil
+		return
+	}
+	p.open--
+}
+
+// closeLocked closes the connection and frees its slot.
+func (p *connPool) closeLocked(pc *poolConn) {
+	pc.Close()
+	p.releaseLocked()
+}
+
+func (p *connPool) removeWaiterLocked(ch chan *poolConn) bool {
+	for i, w := range p.waiters {
+		if w == ch {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *connPool) expired(pc *poolConn, now time.Time) bool {
+	return p.maxLifetime > 0 && now.Sub(pc.createdAt) >= p.maxLifetime
+}
+
+// close closes every idle connection and fails the waiters. Connections in
+// use are closed when returned.
+func (p *connPool) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.stop)
+
+	for _, ch := range p.waiters {
+		ch <- poolClosed
+	}
+	p.waiters = nil
+
+	for _, pc := range p.idle {
+		p.closeLocked(pc)
+	}
+	p.idle = nil
+	p.mu.Unlock()
+
+	<-p.stopped
+}
+
+func (p *connPool) snapshot() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Open = p.open
+	stats.Idle = len(p.idle)
+	stats.InUse = p.open - len(p.idle)
+	stats.Waiting = len(p.waiters)
+	return stats
+}
+
+// maintain periodically evicts expired connections and health checks the
+// idle ones.
+func (p *connPool) maintain() {
+	defer close(p.stopped)
+
+	interval := p.maintenanceInterval()
+	if interval <= 0 {
+		<-p.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.evict()
+			p.checkHealth()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *connPool) maintenanceInterval() time.Duration {
+	var interval time.Duration
+	for _, d := range []time.Duration{p.idleTimeout / 2, p.maxLifetime / 2, p.healthInterval} {
+		if d > 0 && (interval == 0 || d < interval) {
+			interval = d
+		}
+	}
+
+	if interval > 0 && interval < minMaintenanceInterval {
+		interval = minMaintenanceInterval
+	}
+	return interval
+}
+
+// evict closes the idle connections past their idle timeout or lifetime,
+// keeping at least minIdle connections that are only idle.
+func (p *connPool) evict() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	kept := p.idle[:0]
+	// The oldest idle connections are at the bottom of the stack.
+	for i, pc := range p.idle {
+		remaining := len(p.idle) - i
+		switch {
+		case p.expired(pc, now):
+			p.stats.ClosedLifetime++
+			p.closeLocked(pc)
+		case p.idleTimeout > 0 && now.Sub(pc.lastUsed) >= p.idleTimeout && len(kept)+remaining > p.minIdle:
+			p.stats.ClosedIdle++
+			p.closeLocked(pc)
+		default:
+			kept = append(kept, pc)
+		}
+	}
+	p.idle = kept
+}
+
+// checkHealth runs the health check on every idle connection once the health
+// interval has passed. Connections are taken out of the pool while checked.
+func (p *connPool) checkHealth() {
+	if p.healthInterval <= 0 || p.healthCheck == nil {
+		return
+	}
+
+	p.mu.Lock()
+	if time.Since(p.lastHealth) < p.healthInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastHealth = time.Now()
+	conns := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, pc := range conns {
+		if err := p.healthCheck(pc); err != nil {
+			p.mu.Lock()
+			p.stats.ClosedHealthCheck++
+			p.closeLocked(pc)
+			p.mu.Unlock()
+			continue
+		}
+
+		// Health checks do not count as use for the idle timeout.
+		lastUsed := pc.lastUsed
+		p.put(pc, nil)
+		p.mu.Lock()
+		pc.lastUsed = lastUsed
+		p.mu.Unlock()
+	}
+}
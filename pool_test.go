@@ -0,0 +1,218 @@
+package bloomd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pipeDialer returns a dial function handing out in-memory connections.
+func pipeDialer(dials *int32) func(ctx context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		atomic.AddInt32(dials, 1)
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+}
+
+func TestPoolBlocksWhenFull(t *testing.T) {
+	assert := assert.New(t)
+
+	var dials int32
+	pool := newConnPool(pipeDialer(&dials), nil, poolConfig{maxConns: 1})
+	defer pool.close()
+
+	ctx := context.Background()
+	conn, err := pool.get(ctx)
+	assert.NoError(err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.get(timeoutCtx)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	got := make(chan *poolConn)
+	go func() {
+		c, _ := pool.get(ctx)
+		got <- c
+	}()
+
+	assert.True(eventually(func() bool { return pool.snapshot().Waiting == 1 }))
+	pool.put(conn, nil)
+	assert.Equal(conn, <-got)
+
+	stats := pool.snapshot()
+	assert.Equal(1, stats.Open)
+	assert.Equal(1, stats.InUse)
+	assert.Equal(int64(2), stats.Waits)
+	assert.Equal(int32(1), atomic.LoadInt32(&dials))
+}
+
+func TestPoolFillStopsWhenFull(t *testing.T) {
+	assert := assert.New(t)
+
+	var dials int32
+	pool := newConnPool(pipeDialer(&dials), nil, poolConfig{maxConns: 2})
+	defer pool.close()
+
+	ctx := context.Background()
+	assert.NoError(pool.fill(ctx, 5))
+	assert.Equal(2, pool.snapshot().Idle)
+
+	// Connections in use are not waited for.
+	conn, err := pool.get(ctx)
+	assert.NoError(err)
+	other, err := pool.get(ctx)
+	assert.NoError(err)
+	assert.NoError(pool.fill(ctx, 1))
+	pool.put(conn, nil)
+	pool.put(other, nil)
+	assert.Equal(int32(2), atomic.LoadInt32(&dials))
+}
+
+func TestPoolDiscardsErroredConnections(t *testing.T) {
+	assert := assert.New(t)
+
+	var dials int32
+	pool := newConnPool(pipeDialer(&dials), nil, poolConfig{maxConns: 1})
+	defer pool.close()
+
+	ctx := context.Background()
+	conn, err := pool.get(ctx)
+	assert.NoError(err)
+
+	got := make(chan *poolConn)
+	go func() {
+		c, _ := pool.get(ctx)
+		got <- c
+	}()
+
+	assert.True(eventually(func() bool { return pool.snapshot().Waiting == 1 }))
+	pool.put(conn, errors.New("broken"))
+
+	replacement := <-got
+	assert.NotEqual(conn, replacement)
+	pool.put(replacement, nil)
+
+	stats := pool.snapshot()
+	assert.Equal(int64(1), stats.ClosedErrored)
+	assert.Equal(int32(2), atomic.LoadInt32(&dials))
+	assert.Equal(1, stats.Open)
+	assert.Equal(1, stats.Idle)
+}
+
+func TestPoolEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	var dials int32
+	pool := newConnPool(pipeDialer(&dials), nil, poolConfig{maxConns: 3, minIdle: 1, idleTimeout: time.Millisecond})
+	defer pool.close()
+
+	assert.NoError(pool.fill(context.Background(), 3))
+	time.Sleep(5 * time.Millisecond)
+	pool.evict()
+
+	stats := pool.snapshot()
+	assert.Equal(1, stats.Open)
+	assert.Equal(int64(2), stats.ClosedIdle)
+
+	pool = newConnPool(pipeDialer(&dials), nil, poolConfig{maxConns: 3, maxLifetime: time.Millisecond})
+	defer pool.close()
+
+	assert.NoError(pool.fill(context.Background(), 2))
+	time.Sleep(5 * time.Millisecond)
+	conn, err := pool.get(context.Background())
+	assert.NoError(err)
+	assert.True(time.Since(conn.createdAt) < time.Millisecond*5)
+
+	stats = pool.snapshot()
+	assert.Equal(1, stats.Open)
+	assert.Equal(int64(2), stats.ClosedLifetime)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	var dials int32
+	var checks int32
+	healthCheck := func(conn net.Conn) error {
+		if atomic.AddInt32(&checks, 1) == 1 {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+
+	pool := newConnPool(pipeDialer(&dials), healthCheck, poolConfig{maxConns: 2, healthInterval: time.Millisecond})
+	defer pool.close()
+
+	assert.NoError(pool.fill(context.Background(), 2))
+	assert.True(eventually(func() bool { return pool.snapshot().ClosedHealthCheck == 1 }))
+	assert.Equal(1, pool.snapshot().Open)
+}
+
+func TestPoolClose(t *testing.T) {
+	assert := assert.New(t)
+
+	var dials int32
+	pool := newConnPool(pipeDialer(&dials), nil, poolConfig{maxConns: 1})
+
+	ctx := context.Background()
+	conn, err := pool.get(ctx)
+	assert.NoError(err)
+
+	errCh := make(chan error)
+	go func() {
+		_, err := pool.get(ctx)
+		errCh <- err
+	}()
+
+	assert.True(eventually(func() bool { return pool.snapshot().Waiting == 1 }))
+	pool.close()
+	assert.Equal(ErrClientShutdown, <-errCh)
+
+	pool.put(conn, nil)
+	assert.Equal(0, pool.snapshot().Open)
+
+	_, err = pool.get(ctx)
+	assert.Equal(ErrClientShutdown, err)
+}
+
+func TestClientPoolStats(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	client, err := NewClient(server.Addr(), WithInitialConnections(2), WithMaxConnections(4))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.Ping())
+
+	stats := client.PoolStats()
+	assert.Equal(2, stats.Open)
+	assert.Equal(2, stats.Idle)
+	assert.Equal(int64(2), stats.Dials)
+
+	// A response cut short leaves the connection unusable.
+	server.Close()
+	assert.Error(client.Ping())
+	assert.Equal(int64(1), client.PoolStats().ClosedErrored)
+}
+
+func TestClientInitialConnectionsBeyondMax(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+
+	// The default initial connections exceed the maximum.
+	client, err := NewClient(server.Addr(), WithMaxConnections(2))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.Equal(2, client.PoolStats().Open)
+	assert.NoError(client.Ping())
+}
@@ -0,0 +1,262 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Prefix of the filters the client keeps for itself, e.g. alias markers,
+// which provisioning never drops.
+const _INTERNAL_PREFIX = "__bloomd_"
+
+// ProvisionSpec declares the filters a server should have.
+type ProvisionSpec struct {
+	Filters []FilterSpec `json:"filters" yaml:"filters"`
+}
+
+// FilterSpec declares a filter, or with a layout a family of dated filters.
+type FilterSpec struct {
+	Name string `json:"name" yaml:"name"`
+	// Capacity and Probability are left to bloomD's defaults when zero.
+	Capacity    int     `json:"capacity,omitempty" yaml:"capacity,omitempty"`
+	Probability float64 `json:"probability,omitempty" yaml:"probability,omitempty"`
+	InMemory    bool    `json:"in_memory,omitempty" yaml:"in_memory,omitempty"`
+	// Layout makes the spec declare the filters named after the name followed
+	// by a timestamp in the layout, e.g. "20060102" for `events_20261016`.
+	// They are created by their users, e.g. a RotatingFilter, not provisioned.
+	Layout string `json:"layout,omitempty" yaml:"layout,omitempty"`
+	// Retention drops the dated filters older than it, e.g. "720h".
+	Retention string `json:"retention,omitempty" yaml:"retention,omitempty"`
+}
+
+// ParseProvisionSpec parses a spec written in YAML or JSON.
+func ParseProvisionSpec(data []byte) (*ProvisionSpec, error) {
+	spec := &ProvisionSpec{}
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, errors.Wrap(err, "bloomd: invalid provisioning spec")
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// LoadProvisionSpec reads and parses the spec in the file.
+func LoadProvisionSpec(path string) (*ProvisionSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to read provisioning spec")
+	}
+	return ParseProvisionSpec(data)
+}
+
+// Validate checks the spec for invalid or duplicate filters.
+func (s *ProvisionSpec) Validate() error {
+	names := make(map[string]bool, len(s.Filters))
+	for _, f := range s.Filters {
+		switch {
+		case f.Name == "" || strings.ContainsAny(f.Name, " \t\r\n"):
+			return errors.Errorf("bloomd: invalid filter name %q", f.Name)
+		case names[f.Name]:
+			return errors.Errorf("bloomd: filter %s declared twice", f.Name)
+		case f.Probability < 0 || f.Probability >= 1 || (f.Probability > 0 && f.Capacity < 1):
+			return errors.Errorf("bloomd: invalid capacity/probability for %s", f.Name)
+		case f.Retention != "" && f.Layout == "":
+			return errors.Errorf("bloomd: retention for %s requires a layout", f.Name)
+		}
+		names[f.Name] = true
+
+		if _, err := f.retention(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f FilterSpec) retention() (time.Duration, error) {
+	if f.Retention == "" {
+		return 0, nil
+	}
+	retention, err := time.ParseDuration(f.Retention)
+	if err != nil || retention <= 0 {
+		return 0, errors.Errorf("bloomd: invalid retention %q for %s", f.Retention, f.Name)
+	}
+	return retention, nil
+}
+
+// ProvisionAction is what applying a plan does to a filter.
+type ProvisionAction int
+
+const (
+	// ProvisionCreate creates a declared filter missing on the server.
+	ProvisionCreate ProvisionAction = iota
+	// ProvisionDrop drops a dated filter past retention, or an unlisted
+	// filter when asked to.
+	ProvisionDrop
+	// ProvisionMismatch reports a filter whose live parameters differ from
+	// the spec. bloomD cannot change them, so applying leaves it as it is.
+	ProvisionMismatch
+)
+
+func (a ProvisionAction) String() string {
+	switch a {
+	case ProvisionCreate:
+		return "create"
+	case ProvisionDrop:
+		return "drop"
+	case ProvisionMismatch:
+		return "mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// ProvisionChange is a single difference between the spec and the server.
+type ProvisionChange struct {
+	Filter string
+	Action ProvisionAction
+	// Reason explains the change, e.g. "capacity 1000, want 5000".
+	Reason string
+
+	spec FilterSpec
+}
+
+func (c ProvisionChange) String() string {
+	sign := map[ProvisionAction]string{ProvisionCreate: "+", ProvisionDrop: "-", ProvisionMismatch: "~"}[c.Action]
+	if c.Reason == "" {
+		return fmt.Sprintf("%s %s %s", sign, c.Action, c.Filter)
+	}
+	return fmt.Sprintf("%s %s %s (%s)", sign, c.Action, c.Filter, c.Reason)
+}
+
+// ProvisionPlan lists the changes that bring the server in line with a spec,
+// in filter name order.
+type ProvisionPlan struct {
+	Changes []ProvisionChange
+}
+
+// Empty reports whether the server already matches the spec.
+func (p *ProvisionPlan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// PlanProvisioning diffs the spec against the filters on the server. Filters
+// that are not declared are only dropped with dropUnlisted, and the filters
+// the client keeps for itself never are.
+func (t *Client) PlanProvisioning(ctx context.Context, spec *ProvisionSpec, dropUnlisted bool) (*ProvisionPlan, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	filters, err := t.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]BloomFilter, len(filters))
+	for _, filter := range filters {
+		live[filter.Name] = filter
+	}
+
+	plan := &ProvisionPlan{}
+	listed := make(map[string]bool, len(filters))
+	now := time.Now()
+
+	for _, f := range spec.Filters {
+		if f.Layout == "" {
+			listed[f.Name] = true
+			if filter, ok := live[f.Name]; !ok {
+				plan.Changes = append(plan.Changes, ProvisionChange{Filter: f.Name, Action: ProvisionCreate, Reason: f.params(), spec: f})
+			} else if reason := f.mismatch(filter); reason != "" {
+				plan.Changes = append(plan.Changes, ProvisionChange{Filter: f.Name, Action: ProvisionMismatch, Reason: reason})
+			}
+			continue
+		}
+
+		retention, _ := f.retention()
+		for _, filter := range filters {
+			if !strings.HasPrefix(filter.Name, f.Name) {
+				continue
+			}
+			start, err := time.Parse(f.Layout, filter.Name[len(f.Name):])
+			if err != nil {
+				continue
+			}
+			listed[filter.Name] = true
+
+			if retention > 0 && start.Before(now.Add(-retention)) {
+				plan.Changes = append(plan.Changes, ProvisionChange{Filter: filter.Name, Action: ProvisionDrop, Reason: "older than " + retention.String()})
+			} else if reason := f.mismatch(filter); reason != "" {
+				plan.Changes = append(plan.Changes, ProvisionChange{Filter: filter.Name, Action: ProvisionMismatch, Reason: reason})
+			}
+		}
+	}
+
+	if dropUnlisted {
+		for _, filter := range filters {
+			if !listed[filter.Name] && !strings.HasPrefix(filter.Name, _INTERNAL_PREFIX) {
+				plan.Changes = append(plan.Changes, ProvisionChange{Filter: filter.Name, Action: ProvisionDrop, Reason: "not in the spec"})
+			}
+		}
+	}
+
+	sort.SliceStable(plan.Changes, func(i, k int) bool {
+		return plan.Changes[i].Filter < plan.Changes[k].Filter
+	})
+	return plan, nil
+}
+
+// ApplyProvisioning creates and drops the filters of the plan, stopping at
+// the first failure. Mismatches are left as they are. The plan names filters,
+// never aliases.
+func (t *Client) ApplyProvisioning(ctx context.Context, plan *ProvisionPlan) error {
+	for _, c := range plan.Changes {
+		var err error
+		switch c.Action {
+		case ProvisionCreate:
+			err = t.createFilter(ctx, c.Filter, c.spec.Capacity, c.spec.Probability, c.spec.InMemory)
+		case ProvisionDrop:
+			err = t.dropFilter(ctx, c.Filter)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "bloomd: unable to %s %s", c.Action, c.Filter)
+		}
+	}
+	return nil
+}
+
+// params describes the parameters the filter is created with.
+func (f FilterSpec) params() string {
+	var params []string
+	if f.Capacity > 0 {
+		params = append(params, fmt.Sprintf("capacity=%d", f.Capacity))
+	}
+	if f.Probability > 0 {
+		params = append(params, fmt.Sprintf("prob=%g", f.Probability))
+	}
+	if f.InMemory {
+		params = append(params, "in_memory")
+	}
+	return strings.Join(params, " ")
+}
+
+// mismatch describes how the live filter differs from the spec. The in_memory
+// setting is not reported by bloomD, so it is not compared.
+func (f FilterSpec) mismatch(filter BloomFilter) string {
+	var diffs []string
+	if f.Capacity > 0 && filter.Capacity != f.Capacity {
+		diffs = append(diffs, fmt.Sprintf("capacity %d, want %d", filter.Capacity, f.Capacity))
+	}
+	// bloomD reports the probability as a float32.
+	if f.Probability > 0 && math.Abs(float64(filter.Probability)-f.Probability) > f.Probability*1e-3 {
+		diffs = append(diffs, fmt.Sprintf("probability %g, want %g", filter.Probability, f.Probability))
+	}
+	return strings.Join(diffs, ", ")
+}
@@ -0,0 +1,129 @@
+package bloomd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisioning(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.CreateWithParams(ctx, "users", 1000, 0.01, false))
+	assert.NoError(client.CreateWithParams(ctx, "events_20200101", 5000, 0.001, false))
+	assert.NoError(client.CreateWithParams(ctx, "events_20991231", 1000, 0.001, false))
+	assert.NoError(client.Create(ctx, "legacy"))
+	assert.NoError(client.Create(ctx, _ALIAS_PREFIX+":a:1:b::0"))
+
+	spec, err := ParseProvisionSpec([]byte(`
+filters:
+  - name: users
+    capacity: 5000
+    probability: 0.01
+  - name: sessions
+    capacity: 2000
+    probability: 0.001
+    in_memory: true
+  - name: events_
+    capacity: 5000
+    probability: 0.001
+    layout: "20060102"
+    retention: 720h
+`))
+	assert.NoError(err)
+
+	plan, err := client.PlanProvisioning(ctx, spec, false)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"- drop events_20200101 (older than 720h0m0s)",
+		"~ mismatch events_20991231 (capacity 1000, want 5000)",
+		"+ create sessions (capacity=2000 prob=0.001 in_memory)",
+		"~ mismatch users (capacity 1000, want 5000)",
+	}, planLines(plan))
+
+	// Unlisted filters are only dropped when asked to, and internal ones never.
+	plan, err = client.PlanProvisioning(ctx, spec, true)
+	assert.NoError(err)
+	assert.Len(plan.Changes, 5)
+	assert.Equal("- drop legacy (not in the spec)", plan.Changes[2].String())
+
+	assert.NoError(client.ApplyProvisioning(ctx, plan))
+	assert.Contains(server.Commands(), "create sessions capacity=2000 prob=0.001000 in_memory=1")
+	filters, err := client.ListAll(ctx)
+	assert.NoError(err)
+	assert.Len(filters, 4)
+
+	plan, err = client.PlanProvisioning(ctx, spec, true)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"~ mismatch events_20991231 (capacity 1000, want 5000)",
+		"~ mismatch users (capacity 1000, want 5000)",
+	}, planLines(plan))
+
+	// JSON is YAML too.
+	spec, err = ParseProvisionSpec([]byte(`{"filters": [{"name": "users", "capacity": 1000, "probability": 0.01}]}`))
+	assert.NoError(err)
+	plan, err = client.PlanProvisioning(ctx, spec, false)
+	assert.NoError(err)
+	assert.True(plan.Empty())
+}
+
+func TestProvisioningAliases(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	store := NewFileAliasStore(filepath.Join(t.TempDir(), "aliases.json"))
+	client, err := NewClient(server.Addr(), WithAliases(store))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.Create(ctx, "users"))
+	assert.NoError(client.Create(ctx, "users_v2"))
+	assert.NoError(client.SetAlias(ctx, "users", Alias{Target: "users_v2"}))
+
+	spec, err := ParseProvisionSpec([]byte(`{"filters": [{"name": "users_v2"}]}`))
+	assert.NoError(err)
+	plan, err := client.PlanProvisioning(ctx, spec, true)
+	assert.NoError(err)
+	assert.Equal([]string{"- drop users (not in the spec)"}, planLines(plan))
+
+	// The filter is dropped, not the target of the alias by the same name.
+	assert.NoError(client.ApplyProvisioning(ctx, plan))
+	filters, err := client.ListAll(ctx)
+	assert.NoError(err)
+	assert.Len(filters, 1)
+	assert.Equal("users_v2", filters[0].Name)
+}
+
+func TestProvisionSpecErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, spec := range []string{
+		"filters: [{name: a}, {name: a}]",
+		"filters: [{name: 'a b'}]",
+		"filters: [{name: a, probability: 0.01}]",
+		"filters: [{name: a, retention: 24h}]",
+		"filters: [{name: a, layout: '20060102', retention: 1 day}]",
+		"filters: [{name: a, capacity_typo: 1}]",
+	} {
+		_, err := ParseProvisionSpec([]byte(spec))
+		assert.Error(err, spec)
+	}
+}
+
+func planLines(plan *ProvisionPlan) []string {
+	lines := make([]string, len(plan.Changes))
+	for i, c := range plan.Changes {
+		lines[i] = c.String()
+	}
+	return lines
+}
@@ -0,0 +1,340 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultReapInterval = 10 * time.Minute
+	defaultReapTimeout  = time.Minute
+)
+
+// ReapAction is what the Reaper does to a filter.
+type ReapAction int
+
+const (
+	// ReapDrop drops a filter past retention or beyond the maximum count.
+	ReapDrop ReapAction = iota
+	// ReapClose closes an idle filter, unmapping it from memory.
+	ReapClose
+)
+
+func (a ReapAction) String() string {
+	switch a {
+	case ReapDrop:
+		return "drop"
+	case ReapClose:
+		return "close"
+	default:
+		return "unknown"
+	}
+}
+
+// ReapEvent describes a filter the Reaper dropped or closed, or would have in
+// dry-run mode.
+type ReapEvent struct {
+	Filter string
+	Action ReapAction
+	// Reason explains the action, e.g. "older than 720h0m0s".
+	Reason string
+	DryRun bool
+	Err    error
+}
+
+// ReaperOption is configuration setting for the Reaper.
+type ReaperOption func(*reaperOptions)
+
+type reaperOptions struct {
+	audit      func(ReapEvent)
+	dryRun     bool
+	idlePolls  int
+	interval   time.Duration
+	layout     string
+	maxFilters int
+	retention  time.Duration
+}
+
+// WithReapAudit registers a function called with every filter dropped or
+// closed, including failed attempts and those skipped in dry-run mode.
+func WithReapAudit(audit func(ReapEvent)) ReaperOption {
+	return func(o *reaperOptions) {
+		o.audit = audit
+	}
+}
+
+// WithReapDryRun only reports the filters that would be dropped or closed.
+func WithReapDryRun(dryRun bool) ReaperOption {
+	return func(o *reaperOptions) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithReapIdlePolls closes filters whose `Checks` and `Sets` counters did not
+// change for the number of polls. Zero, the default, never closes filters.
+func WithReapIdlePolls(polls int) ReaperOption {
+	return func(o *reaperOptions) {
+		o.idlePolls = polls
+	}
+}
+
+// WithReapInterval sets how often the filters are polled. Zero or less
+// disables the background polls, leaving them to `Reap`. Defaults to 10m.
+func WithReapInterval(interval time.Duration) ReaperOption {
+	return func(o *reaperOptions) {
+		o.interval = interval
+	}
+}
+
+// WithReapLayout sets the time layout the rest of the name after the prefix
+// is parsed with, e.g. "20060102" for `events_20261016`. Filters whose name
+// does not parse are never dropped. Without a layout nothing is dropped.
+func WithReapLayout(layout string) ReaperOption {
+	return func(o *reaperOptions) {
+		o.layout = layout
+	}
+}
+
+// WithReapMaxFilters drops the oldest filters beyond the count. Zero, the
+// default, keeps any number.
+func WithReapMaxFilters(n int) ReaperOption {
+	return func(o *reaperOptions) {
+		o.maxFilters = n
+	}
+}
+
+// WithReapRetention drops filters whose timestamp is older than the
+// retention. Zero, the default, keeps them regardless of age.
+func WithReapRetention(retention time.Duration) ReaperOption {
+	return func(o *reaperOptions) {
+		o.retention = retention
+	}
+}
+
+// Reaper enforces retention on the filters matching a prefix. Filters named
+// after a timestamp are dropped past the retention period or beyond a maximum
+// count, newest kept first, and filters nobody used for a few polls are
+// closed. It is safe for concurrent use.
+type Reaper struct {
+	client *Client
+	prefix string
+	opts   reaperOptions
+	now    func() time.Time
+
+	mu       sync.Mutex
+	counters map[string]*reapCounters
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// reapCounters tracks the activity of a filter between polls.
+type reapCounters struct {
+	checks, sets int
+	canaries     int
+	idle         int
+	closed       bool
+}
+
+type datedFilter struct {
+	name string
+	time time.Time
+}
+
+// NewReaper returns a Reaper for the filters matching the prefix, polling
+// them in the background.
+func NewReaper(client *Client, prefix string, opts ...ReaperOption) (*Reaper, error) {
+	o := reaperOptions{
+		interval: defaultReapInterval,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.retention < 0 || o.maxFilters < 0 || o.idlePolls < 0 {
+		return nil, errors.New("bloomd: invalid reaper retention/count")
+	}
+	if o.layout == "" && (o.retention > 0 || o.maxFilters > 0) {
+		return nil, errors.New("bloomd: reaper retention requires a layout")
+	}
+
+	r := &Reaper{
+		client:   client,
+		prefix:   prefix,
+		opts:     o,
+		now:      time.Now,
+		counters: make(map[string]*reapCounters),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	go r.loop()
+
+	return r, nil
+}
+
+// Reap polls the filters once, dropping and closing them as configured. It
+// returns what was done, and the first error while doing it. It runs in the
+// background unless disabled with `WithReapInterval`.
+func (r *Reaper) Reap(ctx context.Context) ([]ReapEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	filters, err := r.client.ListByPrefix(ctx, r.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ReapEvent
+	var firstErr error
+	record := func(event ReapEvent) {
+		event.DryRun = r.opts.dryRun
+		events = append(events, event)
+		if event.Err != nil && firstErr == nil {
+			firstErr = event.Err
+		}
+		if r.opts.audit != nil {
+			r.opts.audit(event)
+		}
+	}
+
+	dropped := make(map[string]bool)
+	for _, event := range r.expired(filters) {
+		if !r.opts.dryRun {
+			event.Err = r.client.dropFilter(ctx, event.Filter)
+		}
+		if event.Err == nil {
+			dropped[event.Filter] = true
+		}
+		record(event)
+	}
+
+	if r.opts.idlePolls > 0 {
+		seen := make(map[string]bool, len(filters))
+		for _, filter := range filters {
+			if dropped[filter.Name] {
+				continue
+			}
+			seen[filter.Name] = true
+
+			info, err := r.client.filterInfo(ctx, filter.Name)
+			if err == FilterDoesNotExist {
+				continue
+			} else if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			if r.idle(filter.Name, info) {
+				event := ReapEvent{Filter: filter.Name, Action: ReapClose, Reason: "idle"}
+				if !r.opts.dryRun {
+					event.Err = r.client.closeFilter(ctx, filter.Name)
+				}
+				if event.Err == nil {
+					r.counters[filter.Name].closed = true
+				}
+				record(event)
+			}
+		}
+
+		for name := range r.counters {
+			if !seen[name] {
+				delete(r.counters, name)
+			}
+		}
+	}
+
+	return events, firstErr
+}
+
+// expired returns the drops of the dated filters past retention or beyond the
+// maximum count.
+func (r *Reaper) expired(filters []BloomFilter) []ReapEvent {
+	if r.opts.layout == "" {
+		return nil
+	}
+
+	var dated []datedFilter
+	for _, filter := range filters {
+		t, err := time.Parse(r.opts.layout, strings.TrimPrefix(filter.Name, r.prefix))
+		if err == nil {
+			dated = append(dated, datedFilter{name: filter.Name, time: t})
+		}
+	}
+	sort.Slice(dated, func(i, k int) bool {
+		return dated[i].time.After(dated[k].time)
+	})
+
+	var events []ReapEvent
+	oldest := r.now().Add(-r.opts.retention)
+	for i, filter := range dated {
+		switch {
+		case r.opts.retention > 0 && filter.time.Before(oldest):
+			events = append(events, ReapEvent{Filter: filter.name, Action: ReapDrop, Reason: "older than " + r.opts.retention.String()})
+		case r.opts.maxFilters > 0 && i >= r.opts.maxFilters:
+			events = append(events, ReapEvent{Filter: filter.name, Action: ReapDrop, Reason: fmt.Sprintf("beyond the newest %d", r.opts.maxFilters)})
+		}
+	}
+	return events
+}
+
+// idle records the counters of the filter and reports whether it should be
+// closed. A closed filter is not closed again until it is used. The canary
+// checks of the client are not use, but map a closed filter in again.
+func (r *Reaper) idle(name string, info VerboseBloomFilter) bool {
+	canaries := r.client.canaries.get(name)
+	checks := info.Checks - canaries
+
+	c, ok := r.counters[name]
+	if !ok || c.checks != checks || c.sets != info.Sets {
+		r.counters[name] = &reapCounters{checks: checks, sets: info.Sets, canaries: canaries}
+		return false
+	}
+	if c.canaries != canaries {
+		c.canaries = canaries
+		c.closed = false
+	}
+
+	c.idle++
+	return !c.closed && c.idle >= r.opts.idlePolls
+}
+
+// Close stops the background polls.
+func (r *Reaper) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	<-r.stopped
+}
+
+func (r *Reaper) loop() {
+	defer close(r.stopped)
+
+	if r.opts.interval <= 0 {
+		<-r.stop
+		return
+	}
+
+	ticker := time.NewTicker(r.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultReapTimeout)
+			r.Reap(ctx)
+			cancel()
+		case <-r.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaper(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	for _, name := range []string{"daily_20261010", "daily_20261014", "daily_20261015", "daily_20261016", "daily_current", "other_20260101"} {
+		assert.NoError(client.Create(ctx, name))
+	}
+
+	var audited []ReapEvent
+	opts := []ReaperOption{
+		WithReapLayout("20060102"),
+		WithReapRetention(72 * time.Hour),
+		WithReapMaxFilters(2),
+		WithReapInterval(0),
+		WithReapAudit(func(e ReapEvent) { audited = append(audited, e) }),
+	}
+	now := func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) }
+
+	dry, err := NewReaper(client, "daily_", append(opts, WithReapDryRun(true))...)
+	assert.NoError(err)
+	defer dry.Close()
+	dry.now = now
+
+	events, err := dry.Reap(ctx)
+	assert.NoError(err)
+	assert.Equal([]ReapEvent{
+		{Filter: "daily_20261014", Action: ReapDrop, Reason: "beyond the newest 2", DryRun: true},
+		{Filter: "daily_20261010", Action: ReapDrop, Reason: "older than 72h0m0s", DryRun: true},
+	}, events)
+	assert.Equal(events, audited)
+	filters, err := client.ListByPrefix(ctx, "daily_")
+	assert.NoError(err)
+	assert.Len(filters, 5)
+
+	r, err := NewReaper(client, "daily_", append(opts, WithReapIdlePolls(2))...)
+	assert.NoError(err)
+	defer r.Close()
+	r.now = now
+
+	events, err = r.Reap(ctx)
+	assert.NoError(err)
+	assert.Len(events, 2)
+	filters, err = client.ListByPrefix(ctx, "daily_")
+	assert.NoError(err)
+	assert.Len(filters, 3)
+
+	// Filters are closed once their counters stayed the same for two polls.
+	_, err = client.Set(ctx, "daily_current", "a")
+	assert.NoError(err)
+	events, err = r.Reap(ctx)
+	assert.NoError(err)
+	assert.Empty(events)
+	_, err = client.Check(ctx, "daily_current", "a")
+	assert.NoError(err)
+
+	events, err = r.Reap(ctx)
+	assert.NoError(err)
+	assert.Equal([]ReapEvent{
+		{Filter: "daily_20261015", Action: ReapClose, Reason: "idle"},
+		{Filter: "daily_20261016", Action: ReapClose, Reason: "idle"},
+	}, events)
+	assert.Contains(server.Commands(), "close daily_20261016")
+
+	events, err = r.Reap(ctx)
+	assert.NoError(err)
+	assert.Empty(events)
+	events, err = r.Reap(ctx)
+	assert.NoError(err)
+	assert.Equal([]ReapEvent{{Filter: "daily_current", Action: ReapClose, Reason: "idle"}}, events)
+	events, err = r.Reap(ctx)
+	assert.NoError(err)
+	assert.Empty(events)
+
+	_, err = NewReaper(client, "daily_", WithReapRetention(time.Hour))
+	assert.Error(err)
+}
+
+func TestReaperAliases(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	store := NewFileAliasStore(filepath.Join(t.TempDir(), "aliases.json"))
+	client, err := NewClient(server.Addr(), WithAliases(store))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.Create(ctx, "users"))
+	assert.NoError(client.Create(ctx, "users_v2"))
+	assert.NoError(client.SetAlias(ctx, "users", Alias{Target: "users_v2"}))
+
+	r, err := NewReaper(client, "users", WithReapIdlePolls(1), WithReapInterval(0))
+	assert.NoError(err)
+	defer r.Close()
+
+	// The listed filters are reaped, not the target of an alias by the same
+	// name, which is in use.
+	var events []ReapEvent
+	for i := 0; i < 3; i++ {
+		_, err = client.Set(ctx, "users", fmt.Sprintf("key-%d", i))
+		assert.NoError(err)
+		reaped, err := r.Reap(ctx)
+		assert.NoError(err)
+		events = append(events, reaped...)
+	}
+	assert.Equal([]ReapEvent{{Filter: "users", Action: ReapClose, Reason: "idle"}}, events)
+	assert.Contains(server.Commands(), "close users")
+	assert.NotContains(server.Commands(), "close users_v2")
+}
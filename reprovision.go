@@ -0,0 +1,133 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ReprovisionEvent describes a filter bloomD lost, most likely because it
+// restarted.
+type ReprovisionEvent struct {
+	Filter string
+	// Reason is FilterDoesNotExist when the filter disappeared, or
+	// ErrFilterReset when its counters went backwards.
+	Reason error
+	// Recreated reports whether the client created the filter again.
+	Recreated bool
+	// Err is the error creating the filter again, if any.
+	Err error
+}
+
+type filterParams struct {
+	capacity    int
+	probability float64
+	inMemory    bool
+}
+
+// reprovisioner remembers the filters created by the client, to create them
+// again when bloomD loses them, and the last counters of the filters seen by
+// `Info`, to notice when bloomD restarted.
+type reprovisioner struct {
+	handler func(ReprovisionEvent)
+
+	mu       sync.Mutex
+	filters  map[string]filterParams
+	counters map[string]int
+}
+
+func newReprovisioner(handler func(ReprovisionEvent)) *reprovisioner {
+	return &reprovisioner{
+		handler:  handler,
+		filters:  make(map[string]filterParams),
+		counters: make(map[string]int),
+	}
+}
+
+func (r *reprovisioner) remember(name string, params filterParams) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filters[name] = params
+}
+
+func (r *reprovisioner) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.filters, name)
+	delete(r.counters, name)
+}
+
+func (r *reprovisioner) params(name string) (filterParams, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	params, ok := r.filters[name]
+	return params, ok
+}
+
+// observe records the counters of the filter and reports whether they went
+// backwards since last seen.
+func (r *reprovisioner) observe(info VerboseBloomFilter) bool {
+	counters := info.Sets + info.Checks
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last, ok := r.counters[info.Name]
+	r.counters[info.Name] = counters
+	return ok && counters < last
+}
+
+func (r *reprovisioner) notify(event ReprovisionEvent) {
+	if r.handler != nil {
+		r.handler(event)
+	}
+}
+
+// reprovisioned creates the filter again if the request failed because bloomD
+// lost a filter created by this client, and reports whether to retry the
+// request. Only the client that actually recreates it reports the event.
+func (t *Client) reprovisioned(ctx context.Context, name string, err error) bool {
+	if t.reprovision == nil || errors.Cause(err) != FilterDoesNotExist {
+		return false
+	}
+
+	params, ok := t.reprovision.params(name)
+	if !ok {
+		return false
+	}
+
+	cmd := t.buildCreateCommand(name, params.capacity, params.probability, params.inMemory)
+	resp, err := t.sendCommand(ctx, cmd)
+	if err == nil {
+		err = parseCreate(resp)
+	}
+	if err == nil && resp == _RESPONSE_EXISTS {
+		return true
+	}
+
+	t.reprovision.notify(ReprovisionEvent{
+		Filter:    name,
+		Reason:    FilterDoesNotExist,
+		Recreated: err == nil,
+		Err:       err,
+	})
+	return err == nil
+}
+
+// sendBatchReprovisioned sends the batch like `sendBatch`, once more if the
+// filter had to be created. Only bulks create filters from templates.
+func (t *Client) sendBatchReprovisioned(ctx context.Context, cmd string, name string, keys []string) ([]bool, error) {
+	results, err := t.sendBatch(ctx, cmd, name, keys)
+
+	var retry bool
+	if cmd == _BULK {
+		retry = t.autoCreated(ctx, name, err)
+	} else {
+		retry = t.reprovisioned(ctx, name, err)
+	}
+	if retry {
+		results, err = t.sendBatch(ctx, cmd, name, keys)
+	}
+	return results, err
+}
@@ -0,0 +1,76 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReprovisioning(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var events []ReprovisionEvent
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(), WithReprovisioning(func(event ReprovisionEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	assert.NoError(client.CreateWithParams(ctx, "mem", 1000, 0.01, true))
+	assert.NoError(client.Create(ctx, "disk"))
+	_, err = client.Set(ctx, "mem", "a")
+	assert.NoError(err)
+	_, err = client.Set(ctx, "disk", "b")
+	assert.NoError(err)
+	_, err = client.Info(ctx, "disk")
+	assert.NoError(err)
+
+	assert.NoError(server.Restart())
+	assert.True(eventually(func() bool { return client.Ping() == nil }))
+
+	// The in-memory filter is gone, it is recreated and the set retried.
+	added, err := client.Set(ctx, "mem", "c")
+	assert.NoError(err)
+	assert.True(added)
+	assert.True(server.Has("mem", "c"))
+	assert.False(server.Has("mem", "a"))
+	assert.Contains(server.Commands(), "create mem capacity=1000 prob=0.010000 in_memory=1")
+
+	// Asynchronous writes are retried too.
+	assert.NoError(server.Restart())
+	assert.True(eventually(func() bool { return client.Ping() == nil }))
+	added, err = client.SetAsync(ctx, "mem", "d").Wait(ctx)
+	assert.NoError(err)
+	assert.True(added)
+	assert.True(server.Has("mem", "d"))
+
+	// The persisted filter came back with fresh counters.
+	_, err = client.Info(ctx, "disk")
+	assert.NoError(err)
+	present, err := client.Check(ctx, "disk", "b")
+	assert.NoError(err)
+	assert.True(present)
+
+	// Filters unknown to the client are left alone.
+	_, err = client.Check(ctx, "other", "key")
+	assert.Equal(FilterDoesNotExist, err)
+
+	assert.NoError(client.Drop(ctx, "mem"))
+	_, err = client.Multi(ctx, "mem", "c")
+	assert.Equal(FilterDoesNotExist, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]ReprovisionEvent{
+		{Filter: "mem", Reason: FilterDoesNotExist, Recreated: true},
+		{Filter: "mem", Reason: FilterDoesNotExist, Recreated: true},
+		{Filter: "disk", Reason: ErrFilterReset},
+	}, events)
+}
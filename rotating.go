@@ -0,0 +1,289 @@
+package bloomd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRotationBucket   = time.Hour
+	defaultRotationInterval = time.Minute
+	defaultRotationTimeout  = 30 * time.Second
+	defaultRotationWindow   = 24
+)
+
+// RotatingOption is configuration setting for the RotatingFilter.
+type RotatingOption func(*rotatingOptions)
+
+type rotatingOptions struct {
+	bucket    time.Duration
+	interval  time.Duration
+	layout    string
+	retention int
+	template  FilterTemplate
+	window    int
+}
+
+// WithRotationBucket sets the time span covered by each physical filter.
+// Defaults to an hour.
+func WithRotationBucket(bucket time.Duration) RotatingOption {
+	return func(o *rotatingOptions) {
+		o.bucket = bucket
+	}
+}
+
+// WithRotationInterval sets how often the next bucket is created ahead of time
+// and expired buckets are dropped. Zero or less disables the background
+// maintenance, leaving it to `Rotate`. Defaults to a minute.
+func WithRotationInterval(interval time.Duration) RotatingOption {
+	return func(o *rotatingOptions) {
+		o.interval = interval
+	}
+}
+
+// WithRotationLayout sets the time layout of the bucket suffix, e.g.
+// "2006010215" for `events_2026101614`. Defaults to a layout as precise as
+// the bucket span requires.
+func WithRotationLayout(layout string) RotatingOption {
+	return func(o *rotatingOptions) {
+		o.layout = layout
+	}
+}
+
+// WithRotationRetention sets the number of buckets kept, including the current
+// one. Older buckets are dropped. It cannot be less than the window, which is
+// the default.
+func WithRotationRetention(buckets int) RotatingOption {
+	return func(o *rotatingOptions) {
+		o.retention = buckets
+	}
+}
+
+// WithRotationTemplate sets the parameters the buckets are created with.
+func WithRotationTemplate(template FilterTemplate) RotatingOption {
+	return func(o *rotatingOptions) {
+		o.template = template
+	}
+}
+
+// WithRotationWindow sets the number of buckets, including the current one,
+// checked by `Check` and `Multi`. Defaults to 24.
+func WithRotationWindow(buckets int) RotatingOption {
+	return func(o *rotatingOptions) {
+		o.window = buckets
+	}
+}
+
+// RotatingFilter maps a logical filter to time bucketed filters named after
+// the start of their bucket, e.g. `events_2026101614`, for "seen in the last
+// N buckets" semantics. Keys are set in the current bucket and checked across
+// the window. Buckets are created ahead of time and dropped past retention.
+// It is safe for concurrent use.
+type RotatingFilter struct {
+	client *Client
+	name   string
+	opts   rotatingOptions
+	now    func() time.Time
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewRotatingFilter returns a RotatingFilter for the logical name, creating
+// the current and next buckets.
+func NewRotatingFilter(ctx context.Context, client *Client, name string, opts ...RotatingOption) (*RotatingFilter, error) {
+	o := rotatingOptions{
+		bucket:   defaultRotationBucket,
+		interval: defaultRotationInterval,
+		window:   defaultRotationWindow,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.bucket <= 0 || o.window < 1 {
+		return nil, errors.New("bloomd: invalid rotation bucket/window")
+	}
+	if o.retention < o.window {
+		o.retention = o.window
+	}
+	if o.layout == "" {
+		o.layout = bucketLayout(o.bucket)
+	}
+
+	r := &RotatingFilter{
+		client:  client,
+		name:    name,
+		opts:    o,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if err := r.Rotate(ctx); err != nil {
+		return nil, err
+	}
+
+	go r.loop()
+
+	return r, nil
+}
+
+// bucketLayout returns the shortest layout telling buckets apart.
+func bucketLayout(bucket time.Duration) string {
+	switch {
+	case bucket%(24*time.Hour) == 0:
+		return "20060102"
+	case bucket%time.Hour == 0:
+		return "2006010215"
+	case bucket%time.Minute == 0:
+		return "200601021504"
+	default:
+		return "20060102150405"
+	}
+}
+
+// Set sets the key in the current bucket, creating it if needed.
+func (r *RotatingFilter) Set(ctx context.Context, key string) (bool, error) {
+	bucket := r.bucketName(r.current())
+
+	added, err := r.client.Set(ctx, bucket, key)
+	if errors.Cause(err) == FilterDoesNotExist && r.create(ctx, bucket) == nil {
+		added, err = r.client.Set(ctx, bucket, key)
+	}
+	return added, err
+}
+
+// Bulk sets the keys in the current bucket, creating it if needed.
+func (r *RotatingFilter) Bulk(ctx context.Context, keys ...string) ([]bool, error) {
+	bucket := r.bucketName(r.current())
+
+	results, err := r.client.Bulk(ctx, bucket, keys...)
+	if errors.Cause(err) == FilterDoesNotExist && r.create(ctx, bucket) == nil {
+		results, err = r.client.Bulk(ctx, bucket, keys...)
+	}
+	return results, err
+}
+
+// Check reports whether the key was set in any bucket of the window.
+func (r *RotatingFilter) Check(ctx context.Context, key string) (bool, error) {
+	results, err := r.Multi(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+// Multi reports whether each key was set in any bucket of the window. The
+// multi commands for every bucket are pipelined over a single connection. A
+// missing bucket counts as empty.
+func (r *RotatingFilter) Multi(ctx context.Context, keys ...string) ([]bool, error) {
+	return r.client.multiUnion(ctx, r.Buckets(), keys)
+}
+
+// Buckets returns the names of the buckets in the window, newest first.
+func (r *RotatingFilter) Buckets() []string {
+	current := r.current()
+	names := make([]string, r.opts.window)
+	for i := range names {
+		names[i] = r.bucketName(current.Add(-time.Duration(i) * r.opts.bucket))
+	}
+	return names
+}
+
+// Rotate creates the current and next buckets and drops the buckets past
+// retention. It runs in the background unless disabled with
+// `WithRotationInterval`.
+func (r *RotatingFilter) Rotate(ctx context.Context) error {
+	current := r.current()
+	for _, start := range []time.Time{current, current.Add(r.opts.bucket)} {
+		if err := r.create(ctx, r.bucketName(start)); err != nil {
+			return err
+		}
+	}
+
+	filters, err := r.client.ListByPrefix(ctx, r.name+"_")
+	if err != nil {
+		return err
+	}
+
+	oldest := current.Add(-time.Duration(r.opts.retention-1) * r.opts.bucket)
+	for _, filter := range filters {
+		start, ok := r.bucketStart(filter.Name)
+		if !ok || !start.Before(oldest) {
+			continue
+		}
+		if err := r.client.dropFilter(ctx, filter.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the background maintenance. Buckets are left as they are.
+func (r *RotatingFilter) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	<-r.stopped
+}
+
+func (r *RotatingFilter) loop() {
+	defer close(r.stopped)
+
+	if r.opts.interval <= 0 {
+		<-r.stop
+		return
+	}
+
+	ticker := time.NewTicker(r.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultRotationTimeout)
+			r.Rotate(ctx)
+			cancel()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// create creates the bucket. Buckets are created implicitly, so unlike their
+// drops they are not audited.
+func (r *RotatingFilter) create(ctx context.Context, bucket string) error {
+	if err := r.client.checkWritable(); err != nil {
+		return err
+	}
+	tpl := r.opts.template
+	return r.client.create(ctx, bucket, tpl.Capacity, tpl.Probability, tpl.InMemory)
+}
+
+// current returns the start of the current bucket.
+func (r *RotatingFilter) current() time.Time {
+	return r.now().UTC().Truncate(r.opts.bucket)
+}
+
+func (r *RotatingFilter) bucketName(start time.Time) string {
+	return r.name + "_" + start.UTC().Format(r.opts.layout)
+}
+
+// bucketStart parses the start of the bucket from the name of its filter.
+func (r *RotatingFilter) bucketStart(name string) (time.Time, bool) {
+	prefix := r.name + "_"
+	if len(name) <= len(prefix) || name[:len(prefix)] != prefix {
+		return time.Time{}, false
+	}
+
+	start, err := time.Parse(r.opts.layout, name[len(prefix):])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return start, true
+}
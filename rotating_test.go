@@ -0,0 +1,86 @@
+package bloomd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFilter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	var audited []string
+	client, err := NewClient(server.Addr(), WithMaxBatchKeys(2), WithAuditHandler(func(e AuditEvent) {
+		audited = append(audited, e.Command+" "+e.Filter)
+	}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	r, err := NewRotatingFilter(ctx, client, "events",
+		WithRotationWindow(3),
+		WithRotationRetention(4),
+		WithRotationInterval(0),
+		WithRotationTemplate(FilterTemplate{Capacity: 1000}))
+	assert.NoError(err)
+	defer r.Close()
+
+	now := time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	assert.NoError(r.Rotate(ctx))
+	assert.Contains(server.Commands(), "create events_2026101615 capacity=1000")
+
+	_, err = r.Set(ctx, "a")
+	assert.NoError(err)
+	assert.True(server.Has("events_2026101614", "a"))
+
+	now = now.Add(time.Hour)
+	_, err = r.Bulk(ctx, "b", "c", "d")
+	assert.NoError(err)
+	assert.Equal([]string{"events_2026101615", "events_2026101614", "events_2026101613"}, r.Buckets())
+
+	results, err := r.Multi(ctx, "a", "b", "c", "d", "e")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true, true, true, false}, results)
+
+	// Buckets missed by the maintenance are created on write.
+	now = now.Add(2 * time.Hour)
+	_, err = r.Set(ctx, "e")
+	assert.NoError(err)
+
+	present, err := r.Check(ctx, "a")
+	assert.NoError(err)
+	assert.False(present)
+	present, err = r.Check(ctx, "b")
+	assert.NoError(err)
+	assert.True(present)
+
+	assert.NoError(r.Rotate(ctx))
+	filters, err := client.ListByPrefix(ctx, "events_20261016")
+	assert.NoError(err)
+	names := make([]string, len(filters))
+	for i, filter := range filters {
+		names[i] = filter.Name
+	}
+	assert.Equal([]string{"events_2026101614", "events_2026101615", "events_2026101617", "events_2026101618"}, names)
+
+	now = now.Add(time.Hour)
+	assert.NoError(r.Rotate(ctx))
+	assert.False(server.Has("events_2026101614", "a"))
+	_, err = client.Info(ctx, "events_2026101614")
+	assert.Equal(FilterDoesNotExist, err)
+
+	// Only the drops past retention are audited.
+	assert.Equal([]string{"drop events_2026101614"}, audited)
+}
+
+func TestBucketLayout(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("20060102", bucketLayout(48*time.Hour))
+	assert.Equal("2006010215", bucketLayout(time.Hour))
+	assert.Equal("200601021504", bucketLayout(15*time.Minute))
+	assert.Equal("20060102150405", bucketLayout(30*time.Second))
+}
@@ -0,0 +1,320 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultGrowthCapacity    = 100000
+	defaultGrowthFactor      = 2
+	defaultGrowthInterval    = time.Minute
+	defaultGrowthProbability = 0.0001
+	defaultGrowthThreshold   = 0.9
+	defaultGrowthTightening  = 0.9
+	defaultGrowthTimeout     = 30 * time.Second
+
+	_GENERATION_SEPARATOR = "_g"
+)
+
+// ScalableOption is configuration setting for the ScalableFilter.
+type ScalableOption func(*scalableOptions)
+
+type scalableOptions struct {
+	capacity    int
+	factor      float64
+	inMemory    bool
+	interval    time.Duration
+	probability float64
+	threshold   float64
+	tightening  float64
+}
+
+// WithGrowthFactor sets how much larger the capacity of every new generation
+// is. Defaults to 2.
+func WithGrowthFactor(factor float64) ScalableOption {
+	return func(o *scalableOptions) {
+		o.factor = factor
+	}
+}
+
+// WithGrowthInitial sets the capacity and false positive probability of the
+// first generation. Defaults to 100000 and 0.0001.
+func WithGrowthInitial(capacity int, probability float64) ScalableOption {
+	return func(o *scalableOptions) {
+		o.capacity = capacity
+		o.probability = probability
+	}
+}
+
+// WithGrowthInMemory creates the generations with `in_memory`.
+func WithGrowthInMemory(inMemory bool) ScalableOption {
+	return func(o *scalableOptions) {
+		o.inMemory = inMemory
+	}
+}
+
+// WithGrowthInterval sets how often the newest generation is checked for
+// growth. Zero or less disables the background checks, leaving them to `Grow`.
+// Defaults to a minute.
+func WithGrowthInterval(interval time.Duration) ScalableOption {
+	return func(o *scalableOptions) {
+		o.interval = interval
+	}
+}
+
+// WithGrowthThreshold sets the fraction of its capacity the newest generation
+// may fill before a new one is created. Defaults to 0.9.
+func WithGrowthThreshold(threshold float64) ScalableOption {
+	return func(o *scalableOptions) {
+		o.threshold = threshold
+	}
+}
+
+// WithGrowthTightening sets the ratio the false positive probability of every
+// new generation is multiplied by, so the union across generations stays
+// bounded. Defaults to 0.9, like bloomD's own scaling.
+func WithGrowthTightening(tightening float64) ScalableOption {
+	return func(o *scalableOptions) {
+		o.tightening = tightening
+	}
+}
+
+// ScalableFilter chains generations of filters named after the logical name
+// and their generation, e.g. `users_g0003`. Once the newest generation nears
+// its capacity, a larger generation with a tighter probability is created.
+// Keys are set in the newest generation and checked across all of them. The
+// chain is rebuilt from `ListByPrefix`, so it needs no state besides bloomD.
+// It is safe for concurrent use.
+type ScalableFilter struct {
+	client *Client
+	name   string
+	opts   scalableOptions
+
+	mu          sync.RWMutex
+	generations []BloomFilter
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewScalableFilter returns a ScalableFilter for the logical name, creating
+// the first generation if bloomD has none.
+func NewScalableFilter(ctx context.Context, client *Client, name string, opts ...ScalableOption) (*ScalableFilter, error) {
+	o := scalableOptions{
+		capacity:    defaultGrowthCapacity,
+		factor:      defaultGrowthFactor,
+		interval:    defaultGrowthInterval,
+		probability: defaultGrowthProbability,
+		threshold:   defaultGrowthThreshold,
+		tightening:  defaultGrowthTightening,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.capacity < 1 || o.probability <= 0 || o.probability >= 1 {
+		return nil, errors.New("bloomd: invalid capacity/probability")
+	}
+
+	s := &ScalableFilter{
+		client:  client,
+		name:    name,
+		opts:    o,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if err := s.Grow(ctx); err != nil {
+		return nil, err
+	}
+
+	go s.loop()
+
+	return s, nil
+}
+
+// Set sets the key in the newest generation.
+func (s *ScalableFilter) Set(ctx context.Context, key string) (bool, error) {
+	added, err := s.client.Set(ctx, s.newest(), key)
+	if errors.Cause(err) == FilterDoesNotExist && s.refresh(ctx) == nil {
+		added, err = s.client.Set(ctx, s.newest(), key)
+	}
+	return added, err
+}
+
+// Bulk sets the keys in the newest generation.
+func (s *ScalableFilter) Bulk(ctx context.Context, keys ...string) ([]bool, error) {
+	results, err := s.client.Bulk(ctx, s.newest(), keys...)
+	if errors.Cause(err) == FilterDoesNotExist && s.refresh(ctx) == nil {
+		results, err = s.client.Bulk(ctx, s.newest(), keys...)
+	}
+	return results, err
+}
+
+// Check reports whether the key is in any generation.
+func (s *ScalableFilter) Check(ctx context.Context, key string) (bool, error) {
+	results, err := s.Multi(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+// Multi reports whether each key is in any generation. The multi commands for
+// every generation are pipelined over a single connection.
+func (s *ScalableFilter) Multi(ctx context.Context, keys ...string) ([]bool, error) {
+	return s.client.multiUnion(ctx, s.Generations(), keys)
+}
+
+// Generations returns the names of the generations, newest first.
+func (s *ScalableFilter) Generations() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, len(s.generations))
+	for i, g := range s.generations {
+		names[len(names)-1-i] = g.Name
+	}
+	return names
+}
+
+// Grow rebuilds the chain from bloomD and creates a new generation if the
+// newest one filled past the threshold. It runs in the background unless
+// disabled with `WithGrowthInterval`.
+func (s *ScalableFilter) Grow(ctx context.Context) error {
+	if err := s.refresh(ctx); err != nil {
+		return err
+	}
+
+	newest := s.newest()
+	info, err := s.client.filterInfo(ctx, newest)
+	if err != nil {
+		return err
+	}
+	if float64(info.Size) < s.opts.threshold*float64(info.Capacity) {
+		return nil
+	}
+
+	gen, err := parseGeneration(s.name, newest)
+	if err != nil {
+		return err
+	}
+	capacity := int(float64(info.Capacity) * s.opts.factor)
+	probability := float64(info.Probability) * s.opts.tightening
+	if err := s.create(ctx, gen+1, capacity, probability); err != nil {
+		return err
+	}
+	return s.refresh(ctx)
+}
+
+// Close stops the background growth checks. Generations are left as they
+// are.
+func (s *ScalableFilter) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.stopped
+}
+
+func (s *ScalableFilter) loop() {
+	defer close(s.stopped)
+
+	if s.opts.interval <= 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(s.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultGrowthTimeout)
+			s.Grow(ctx)
+			cancel()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// refresh lists the generations, creating the first one if there is none.
+func (s *ScalableFilter) refresh(ctx context.Context) error {
+	filters, err := s.client.ListByPrefix(ctx, s.name+_GENERATION_SEPARATOR)
+	if err != nil {
+		return err
+	}
+
+	var generations []BloomFilter
+	gens := make(map[string]int)
+	for _, filter := range filters {
+		if gen, err := parseGeneration(s.name, filter.Name); err == nil {
+			generations = append(generations, filter)
+			gens[filter.Name] = gen
+		}
+	}
+
+	if len(generations) == 0 {
+		if err := s.create(ctx, 1, s.opts.capacity, s.opts.probability); err != nil {
+			return err
+		}
+		generations = []BloomFilter{{
+			Name:        generationName(s.name, 1),
+			Capacity:    s.opts.capacity,
+			Probability: float32(s.opts.probability),
+		}}
+	}
+
+	sort.Slice(generations, func(i, k int) bool {
+		return gens[generations[i].Name] < gens[generations[k].Name]
+	})
+
+	s.mu.Lock()
+	s.generations = generations
+	s.mu.Unlock()
+	return nil
+}
+
+// create creates the generation. Generations are created implicitly, so they
+// are not audited.
+func (s *ScalableFilter) create(ctx context.Context, gen int, capacity int, probability float64) error {
+	if err := s.client.checkWritable(); err != nil {
+		return err
+	}
+	return s.client.create(ctx, generationName(s.name, gen), capacity, probability, s.opts.inMemory)
+}
+
+func (s *ScalableFilter) newest() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generations[len(s.generations)-1].Name
+}
+
+func generationName(name string, gen int) string {
+	return fmt.Sprintf("%s%s%04d", name, _GENERATION_SEPARATOR, gen)
+}
+
+// parseGeneration returns the generation of the filter of the chain.
+func parseGeneration(name string, filter string) (int, error) {
+	prefix := name + _GENERATION_SEPARATOR
+	suffix := strings.TrimPrefix(filter, prefix)
+	if suffix == filter || len(suffix) < 4 {
+		return 0, errors.Errorf("bloomd: %s is not a generation of %s", filter, name)
+	}
+
+	gen, err := strconv.Atoi(suffix)
+	if err != nil || gen < 1 {
+		return 0, errors.Errorf("bloomd: %s is not a generation of %s", filter, name)
+	}
+	return gen, nil
+}
@@ -0,0 +1,79 @@
+package bloomd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScalableFilter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	var audited []string
+	client, err := NewClient(server.Addr(), WithAuditHandler(func(e AuditEvent) {
+		audited = append(audited, e.Command+" "+e.Filter)
+	}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	opts := []ScalableOption{
+		WithGrowthInitial(4, 0.01),
+		WithGrowthThreshold(0.5),
+		WithGrowthInterval(0),
+	}
+	s, err := NewScalableFilter(ctx, client, "users", opts...)
+	assert.NoError(err)
+	defer s.Close()
+	assert.Equal([]string{"users_g0001"}, s.Generations())
+
+	_, err = s.Bulk(ctx, "a", "b")
+	assert.NoError(err)
+	assert.NoError(s.Grow(ctx))
+	assert.Equal([]string{"users_g0002", "users_g0001"}, s.Generations())
+	assert.Contains(server.Commands(), "create users_g0002 capacity=8 prob=0.009000")
+
+	// Growth is only checked on the newest generation.
+	assert.NoError(s.Grow(ctx))
+	assert.Len(s.Generations(), 2)
+
+	_, err = s.Set(ctx, "c")
+	assert.NoError(err)
+	assert.True(server.Has("users_g0002", "c"))
+
+	results, err := s.Multi(ctx, "a", "c", "d")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true, false}, results)
+
+	// A new client rebuilds the chain from bloomD, ignoring unrelated filters.
+	assert.NoError(client.Create(ctx, "users_gone"))
+	other, err := NewScalableFilter(ctx, client, "users", opts...)
+	assert.NoError(err)
+	defer other.Close()
+	assert.Equal([]string{"users_g0002", "users_g0001"}, other.Generations())
+
+	present, err := other.Check(ctx, "b")
+	assert.NoError(err)
+	assert.True(present)
+
+	// Generations are not audited.
+	assert.Equal([]string{"create users_gone"}, audited)
+}
+
+func TestParseGeneration(t *testing.T) {
+	assert := assert.New(t)
+
+	gen, err := parseGeneration("users", "users_g0012")
+	assert.NoError(err)
+	assert.Equal(12, gen)
+	gen, err = parseGeneration("users", generationName("users", 12345))
+	assert.NoError(err)
+	assert.Equal(12345, gen)
+
+	for _, name := range []string{"users", "users_g", "users_g12", "users_gone", "other_g0001", "users_g0000"} {
+		_, err := parseGeneration("users", name)
+		assert.Error(err, name)
+	}
+}
@@ -0,0 +1,60 @@
+package bloomd
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// FilterTemplate holds the parameters of the filters created on first use,
+// see `WithFilterTemplate`. Zero values use the bloomD defaults.
+type FilterTemplate struct {
+	Capacity    int
+	Probability float64
+	InMemory    bool
+}
+
+type namedTemplate struct {
+	pattern  string
+	template FilterTemplate
+}
+
+// template returns the template of the filter. A template registered for the
+// exact name wins over patterns, which are tried in registration order.
+func (t *Client) template(name string) (FilterTemplate, bool) {
+	var matched *namedTemplate
+	for i, tpl := range t.templates {
+		if tpl.pattern == name {
+			return tpl.template, true
+		}
+		if matched == nil {
+			if ok, _ := path.Match(tpl.pattern, name); ok {
+				matched = &t.templates[i]
+			}
+		}
+	}
+
+	if matched == nil {
+		return FilterTemplate{}, false
+	}
+	return matched.template, true
+}
+
+// autoCreated creates the filter if a write failed because it does not exist,
+// either again for a lost filter or from its template, and reports whether to
+// retry the write.
+func (t *Client) autoCreated(ctx context.Context, name string, err error) bool {
+	if t.reprovisioned(ctx, name, err) {
+		return true
+	}
+	if len(t.templates) == 0 || errors.Cause(err) != FilterDoesNotExist {
+		return false
+	}
+
+	tpl, ok := t.template(name)
+	if !ok {
+		return false
+	}
+	return t.create(ctx, name, tpl.Capacity, tpl.Probability, tpl.InMemory) == nil
+}
@@ -0,0 +1,91 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterTemplates(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var audited int32
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(),
+		WithAuditHandler(func(AuditEvent) { atomic.AddInt32(&audited, 1) }),
+		WithFilterTemplate("events-*", FilterTemplate{Capacity: 1000, Probability: 0.01}),
+		WithFilterTemplate("events-mem", FilterTemplate{Capacity: 500, InMemory: true}),
+		WithFilterTemplate("*", FilterTemplate{}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	tpl, ok := client.template("events-mem")
+	assert.True(ok)
+	assert.Equal(FilterTemplate{Capacity: 500, InMemory: true}, tpl)
+	tpl, ok = client.template("events-1")
+	assert.True(ok)
+	assert.Equal(1000, tpl.Capacity)
+	tpl, ok = client.template("other")
+	assert.True(ok)
+	assert.Equal(FilterTemplate{}, tpl)
+
+	// Concurrent first writes all succeed.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := client.Set(ctx, "events-1", fmt.Sprintf("key-%d", i))
+			assert.NoError(err)
+		}(i)
+	}
+	wg.Wait()
+	assert.True(server.Has("events-1", "key-9"))
+
+	results, err := client.Bulk(ctx, "events-mem", "a", "b")
+	assert.NoError(err)
+	assert.Equal([]bool{true, true}, results)
+
+	info, err := client.Info(ctx, "events-1")
+	assert.NoError(err)
+	assert.Equal(1000, info.Capacity)
+	assert.Contains(server.Commands(), "create events-mem capacity=500 in_memory=1")
+
+	// So do asynchronous writes.
+	added, err := client.SetAsync(ctx, "events-3", "a").Wait(ctx)
+	assert.NoError(err)
+	assert.True(added)
+	results, err = client.BulkAsync(ctx, "events-4", "a", "b").Wait(ctx)
+	assert.NoError(err)
+	assert.Equal([]bool{true, true}, results)
+	assert.True(server.Has("events-4", "b"))
+
+	// Reads never create filters.
+	_, err = client.Check(ctx, "events-2", "key")
+	assert.Equal(FilterDoesNotExist, err)
+	_, err = client.Info(ctx, "events-2")
+	assert.Equal(FilterDoesNotExist, err)
+
+	// Filters created from templates are not admin commands.
+	assert.Equal(int32(0), atomic.LoadInt32(&audited))
+}
+
+func TestNoFilterTemplate(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	server := newFakeBloomd(t)
+	client, err := NewClient(server.Addr(), WithFilterTemplate("events-*", FilterTemplate{}))
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	_, err = client.Set(ctx, "other", "key")
+	assert.Equal(FilterDoesNotExist, err)
+	_, err = client.Bulk(ctx, "other", "key")
+	assert.Equal(FilterDoesNotExist, err)
+}
@@ -0,0 +1,238 @@
+package bloomd
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultUDPFlushInterval = 10 * time.Millisecond
+	defaultUDPHashKeys      = false
+	// Leaves room for the IP and UDP headers in a 1500 bytes ethernet frame.
+	defaultUDPMTU = 1472
+)
+
+// UDPOption is configuration setting for the UDPWriter.
+type UDPOption func(*udpOptions)
+
+type udpOptions struct {
+	flushInterval time.Duration
+	hashKeys      bool
+	mtu           int
+}
+
+// WithUDPFlushInterval sets how long commands may wait for a datagram to fill
+// up before it is sent anyway. An interval of zero or less only sends full
+// datagrams and on `Flush`.
+func WithUDPFlushInterval(flushInterval time.Duration) UDPOption {
+	return func(o *udpOptions) {
+		o.flushInterval = flushInterval
+	}
+}
+
+// WithUDPHashKeys forces keys to be hashed before being sent to the bloomD,
+// the same way `WithHashKeys` does for the client.
+func WithUDPHashKeys(hashKeys bool) UDPOption {
+	return func(o *udpOptions) {
+		o.hashKeys = hashKeys
+	}
+}
+
+// WithUDPMTU sets the maximum size of a datagram. Commands are packed into
+// datagrams up to this size.
+func WithUDPMTU(mtu int) UDPOption {
+	return func(o *udpOptions) {
+		o.mtu = mtu
+	}
+}
+
+// UDPStats is a snapshot of the UDPWriter counters.
+type UDPStats struct {
+	BytesSent    int64
+	PacketsSent  int64
+	CommandsSent int64
+	SendErrors   int64
+}
+
+// UDPWriter sends set and bulk commands to bloomD's UDP interface. There is
+// no reply, so writes may be lost without notice. Commands are packed into as
+// few datagrams as possible. It is safe for concurrent use.
+type UDPWriter struct {
+	// Accessed atomically, keep at the top for alignment.
+	bytesSent    int64
+	packetsSent  int64
+	commandsSent int64
+	sendErrors   int64
+
+	conn net.Conn
+	opts udpOptions
+
+	mu       sync.Mutex
+	buf      []byte
+	commands int64
+	closed   bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewUDPWriter returns a UDPWriter sending to the bloomD UDP address.
+func NewUDPWriter(addr string, opts ...UDPOption) (*UDPWriter, error) {
+	o := udpOptions{
+		flushInterval: defaultUDPFlushInterval,
+		hashKeys:      defaultUDPHashKeys,
+		mtu:           defaultUDPMTU,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "bloomd: unable to create udp connection")
+	}
+
+	w := &UDPWriter{
+		conn:    conn,
+		opts:    o,
+		buf:     make([]byte, 0, o.mtu),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go w.loop()
+
+	return w, nil
+}
+
+// Set queues a set of the key in the filter.
+func (w *UDPWriter) Set(name string, key string) error {
+	return w.write(_SET + " " + name + " " + w.hashKey(key))
+}
+
+// Bulk queues a set of many keys in the filter. Keys that do not fit in a
+// single datagram are split into several bulk commands.
+func (w *UDPWriter) Bulk(name string, keys ...string) error {
+	for _, c := range splitChunks(_BULK, name, keys, w.hashKey, 0, w.opts.mtu) {
+		if err := w.write(c.cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush sends every queued command.
+func (w *UDPWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushLocked()
+}
+
+// Close flushes the queued commands and closes the socket.
+func (w *UDPWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stop)
+	err := w.flushLocked()
+	w.mu.Unlock()
+
+	<-w.stopped
+	if cerr := w.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Stats returns a snapshot of the counters.
+func (w *UDPWriter) Stats() UDPStats {
+	return UDPStats{
+		BytesSent:    atomic.LoadInt64(&w.bytesSent),
+		PacketsSent:  atomic.LoadInt64(&w.packetsSent),
+		CommandsSent: atomic.LoadInt64(&w.commandsSent),
+		SendErrors:   atomic.LoadInt64(&w.sendErrors),
+	}
+}
+
+func (w *UDPWriter) hashKey(key string) string {
+	if w.opts.hashKeys {
+		return sha1Key(key)
+	}
+	return key
+}
+
+// write appends the command to the pending datagram, sending the datagram
+// first if the command would not fit.
+func (w *UDPWriter) write(cmd string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrUDPWriterClosed
+	}
+
+	if len(w.buf) > 0 && len(w.buf)+len(cmd)+1 > w.opts.mtu {
+		if err := w.flushLocked(); err != nil {
+			return err
+		}
+	}
+
+	w.buf = append(w.buf, cmd...)
+	w.buf = append(w.buf, '\n')
+	w.commands++
+
+	if len(w.buf) >= w.opts.mtu {
+		return w.flushLocked()
+	}
+	return nil
+}
+
+// flushLocked sends the pending datagram. Requires the lock to be held.
+func (w *UDPWriter) flushLocked() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	n, err := w.conn.Write(w.buf)
+	commands := w.commands
+	w.buf = w.buf[:0]
+	w.commands = 0
+
+	if err != nil {
+		atomic.AddInt64(&w.sendErrors, 1)
+		return errors.Wrap(err, "bloomd: unable to write to udp connection")
+	}
+
+	atomic.AddInt64(&w.bytesSent, int64(n))
+	atomic.AddInt64(&w.packetsSent, 1)
+	atomic.AddInt64(&w.commandsSent, commands)
+	return nil
+}
+
+func (w *UDPWriter) loop() {
+	defer close(w.stopped)
+
+	if w.opts.flushInterval <= 0 {
+		<-w.stop
+		return
+	}
+
+	ticker := time.NewTicker(w.opts.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.stop:
+			return
+		}
+	}
+}
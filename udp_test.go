@@ -0,0 +1,74 @@
+package bloomd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPWriter(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+	udpAddr, err := server.ListenUDP()
+	assert.NoError(err)
+
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+
+	ctx := context.Background()
+	assert.NoError(client.Create(ctx, testFilter1))
+
+	writer, err := NewUDPWriter(udpAddr, WithUDPMTU(128), WithUDPFlushInterval(0))
+	assert.NoError(err)
+
+	keys := make([]string, 40)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	for _, key := range keys[:10] {
+		assert.NoError(writer.Set(testFilter1, key))
+	}
+	assert.NoError(writer.Bulk(testFilter1, keys[10:]...))
+	assert.NoError(writer.Close())
+	assert.Equal(ErrUDPWriterClosed, writer.Set(testFilter1, "late"))
+
+	stats := writer.Stats()
+	assert.True(stats.PacketsSent > 1 && stats.PacketsSent < stats.CommandsSent, stats)
+	assert.True(stats.BytesSent <= 128*stats.PacketsSent, stats)
+	assert.Equal(int64(0), stats.SendErrors)
+
+	assert.True(eventually(func() bool {
+		return server.Datagrams() == int(stats.PacketsSent)
+	}))
+
+	r, err := client.Multi(ctx, testFilter1, keys...)
+	assert.NoError(err)
+	for i := range r {
+		assert.True(r[i], keys[i])
+	}
+}
+
+func TestUDPWriterInterval(t *testing.T) {
+	assert := assert.New(t)
+	server := newFakeBloomd(t)
+	udpAddr, err := server.ListenUDP()
+	assert.NoError(err)
+
+	client, err := NewClient(server.Addr())
+	assert.NoError(err)
+	defer client.Shutdown()
+	assert.NoError(client.Create(context.Background(), testFilter1))
+
+	writer, err := NewUDPWriter(udpAddr, WithUDPFlushInterval(time.Millisecond), WithUDPHashKeys(true))
+	assert.NoError(err)
+	defer writer.Close()
+
+	assert.NoError(writer.Set(testFilter1, "key"))
+	assert.True(eventually(func() bool {
+		return server.Has(testFilter1, sha1Key("key"))
+	}))
+}